@@ -5,6 +5,7 @@ import (
 	"github.com/cloudfoundry/loggregatorlib/emitter"
 	"github.com/howeyc/fsnotify"
 	"io/ioutil"
+	"multiline"
 	"path"
 	"runtime"
 	"time"
@@ -12,21 +13,33 @@ import (
 
 type agent struct {
 	InstancesJsonFilePath string
+	multilineConfigs      map[string]multiline.Config
 	logger                *gosteno.Logger
 }
 
-func NewAgent(instancesJsonFilePath string, logger *gosteno.Logger) *agent {
-	return &agent{instancesJsonFilePath, logger}
+// NewAgent creates an agent for the tasks in the instances JSON file. Output
+// of the apps with an entry in multilineConfigs is coalesced into multi-line
+// messages.
+func NewAgent(instancesJsonFilePath string, multilineConfigs map[string]multiline.Config, logger *gosteno.Logger) *agent {
+	return &agent{instancesJsonFilePath, multilineConfigs, logger}
 }
 
 func (agent *agent) Start(emitter emitter.Emitter) {
 	newTasks := agent.watchInstancesJsonFileForChanges()
 	for task := range newTasks {
 		agent.logger.Infof("Starting to listen to %v\n", task.identifier())
-		task.startListening(emitter, agent.logger)
+		task.startListening(emitter, agent.multilineConfigFor(task), agent.logger)
 	}
 }
 
+func (agent *agent) multilineConfigFor(task task) *multiline.Config {
+	config, ok := agent.multilineConfigs[task.applicationId]
+	if !ok {
+		return nil
+	}
+	return &config
+}
+
 func (agent *agent) watchInstancesJsonFileForChanges() chan task {
 	tasksChan := make(chan task)
 	knownTasks := make(map[string]bool)
@@ -53,8 +53,8 @@ func loggregatorAddress() string {
 }
 
 func TestNewAgent(t *testing.T) {
-	actualAgent := NewAgent("path", loggertesthelper.Logger())
-	expectedAgent := &agent{"path", loggertesthelper.Logger()}
+	actualAgent := NewAgent("path", nil, loggertesthelper.Logger())
+	expectedAgent := &agent{"path", nil, loggertesthelper.Logger()}
 	assert.Equal(t, expectedAgent, actualAgent)
 }
 
@@ -105,7 +105,7 @@ func TestTheAgentMonitorsChangesInTasks(t *testing.T) {
 
 	writeToFile(t, `{"instances": [{"state": "RUNNING", "application_id": "1234", "warden_job_id": 56, "warden_container_path":"`+tmpdir+`", "instance_index": 3}]}`, true)
 
-	agent := NewAgent(filePath(), loggertesthelper.Logger())
+	agent := NewAgent(filePath(), nil, loggertesthelper.Logger())
 	go agent.Start(mockLoggregatorEmitter)
 
 	task1Connection, err := task1StdoutListener.Accept()
@@ -164,7 +164,7 @@ func TestTheAgentReadsAllExistingTasks(t *testing.T) {
 
 func TestThatFunctionContinuesToPollWhenFileCantBeOpened(t *testing.T) {
 	os.Remove(filePath())
-	agent := &agent{filePath(), loggertesthelper.Logger()}
+	agent := &agent{filePath(), nil, loggertesthelper.Logger()}
 
 	tasksChan := agent.watchInstancesJsonFileForChanges()
 
@@ -187,7 +187,7 @@ func TestThatFunctionContinuesToPollWhenFileCantBeOpened(t *testing.T) {
 
 func TestThatAnExistingtaskWillBeSeen(t *testing.T) {
 	writeToFile(t, `{"instances": [{"state": "RUNNING", "instance_index": 123}]}`, true)
-	agent := &agent{filePath(), loggertesthelper.Logger()}
+	agent := &agent{filePath(), nil, loggertesthelper.Logger()}
 
 	tasksChan := agent.watchInstancesJsonFileForChanges()
 
@@ -199,7 +199,7 @@ func TestThatAnExistingtaskWillBeSeen(t *testing.T) {
 func TestThatANewtaskWillBeSeen(t *testing.T) {
 	file := createFile(t)
 	defer file.Close()
-	agent := &agent{filePath(), loggertesthelper.Logger()}
+	agent := &agent{filePath(), nil, loggertesthelper.Logger()}
 
 	tasksChan := agent.watchInstancesJsonFileForChanges()
 
@@ -216,7 +216,7 @@ func TestThatANewtaskWillBeSeen(t *testing.T) {
 
 func TestThatOnlyOneNewTasksWillBeSeen(t *testing.T) {
 	writeToFile(t, `{"instances": [{"state": "RUNNING", "instance_index": 123}]}`, true)
-	agent := &agent{filePath(), loggertesthelper.Logger()}
+	agent := &agent{filePath(), nil, loggertesthelper.Logger()}
 
 	tasksChan := agent.watchInstancesJsonFileForChanges()
 
@@ -236,7 +236,7 @@ func TestThatOnlyOneNewTasksWillBeSeen(t *testing.T) {
 
 func TestThatARemovedTaskWillBeRemoved(t *testing.T) {
 	writeToFile(t, `{"instances": [{"state": "RUNNING", "instance_index": 123}]}`, true)
-	agent := &agent{filePath(), loggertesthelper.Logger()}
+	agent := &agent{filePath(), nil, loggertesthelper.Logger()}
 
 	tasksChan := agent.watchInstancesJsonFileForChanges()
 
@@ -10,6 +10,7 @@ import (
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/registrars/collectorregistrar"
 	"github.com/cloudfoundry/loggregatorlib/emitter"
+	"multiline"
 )
 
 type Config struct {
@@ -17,6 +18,10 @@ type Config struct {
 	Index              uint
 	LoggregatorAddress string
 	SharedSecret       string
+
+	// Output of the apps listed here is coalesced into multi-line
+	// messages, keyed by app id.
+	MultilineApps map[string]multiline.Config
 }
 
 func (c *Config) validate(logger *gosteno.Logger) (err error) {
@@ -24,6 +29,13 @@ func (c *Config) validate(logger *gosteno.Logger) (err error) {
 		return errors.New("Need Loggregator address (host:port).")
 	}
 
+	for appId, multilineConfig := range c.MultilineApps {
+		err = multilineConfig.Validate()
+		if err != nil {
+			return fmt.Errorf("Invalid multi-line config for app %s: %v", appId, err)
+		}
+	}
+
 	err = c.Validate(logger)
 	return
 }
@@ -79,7 +91,7 @@ func main() {
 		panic(err)
 	}
 
-	agent := deaagent.NewAgent(*instancesJsonFilePath, logger)
+	agent := deaagent.NewAgent(*instancesJsonFilePath, config.MultilineApps, logger)
 
 	cfc, err := cfcomponent.NewComponent(
 		logger,
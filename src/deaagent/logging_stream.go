@@ -6,6 +6,7 @@ import (
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
 	"github.com/cloudfoundry/loggregatorlib/emitter"
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"multiline"
 	"net"
 	"path/filepath"
 	"runtime"
@@ -19,14 +20,18 @@ type loggingStream struct {
 	emitter          emitter.Emitter
 	logger           *gosteno.Logger
 	messageType      logmessage.LogMessage_MessageType
+	multilineConfig  *multiline.Config
 	messagesReceived *uint64
 	bytesReceived    *uint64
 }
 
 const bufferSize = 4096
 
-func newLoggingStream(task task, emitter emitter.Emitter, logger *gosteno.Logger, messageType logmessage.LogMessage_MessageType) (ls *loggingStream) {
-	return &loggingStream{task, emitter, logger, messageType, new(uint64), new(uint64)}
+// newLoggingStream creates a stream emitting every read from the socket of
+// the task as a message, or, if multilineConfig is not nil, the lines read
+// coalesced into multi-line messages.
+func newLoggingStream(task task, emitter emitter.Emitter, logger *gosteno.Logger, messageType logmessage.LogMessage_MessageType, multilineConfig *multiline.Config) (ls *loggingStream) {
+	return &loggingStream{task, emitter, logger, messageType, multilineConfig, new(uint64), new(uint64)}
 }
 
 func (ls loggingStream) listen() {
@@ -50,6 +55,10 @@ func (ls loggingStream) listen() {
 		return net.Dial("unix", filepath.Join(ls.task.identifier(), socketName(messageType)))
 	}
 
+	emit := func(message []byte) {
+		ls.emitter.EmitLogMessage(newLogMessage(message))
+	}
+
 	go func() {
 		var connection net.Conn
 		i := 0
@@ -75,14 +84,36 @@ func (ls loggingStream) listen() {
 			ls.logger.Infof("Stopped reading from socket %s, %s", ls.messageType, ls.task.identifier())
 		}()
 
+		var coalescer *multiline.Coalescer
+		if ls.multilineConfig != nil {
+			var err error
+			coalescer, err = multiline.NewCoalescer(*ls.multilineConfig)
+			if err != nil {
+				ls.logger.Errorf("Not coalescing multi-line messages from socket %s, %s, %s", ls.messageType, ls.task.identifier(), err)
+			}
+		}
+
 		buffer := make([]byte, bufferSize)
 		totalRead := 0
 		const _skippedBytes = 4
 
 		for {
+			if coalescer != nil {
+				connection.SetReadDeadline(coalescer.Deadline())
+			}
+
 			readCount, err := connection.Read(buffer)
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() && coalescer != nil {
+				if message := coalescer.Flush(); message != nil {
+					emit(message)
+				}
+				continue
+			}
 			if err != nil {
 				ls.logger.Infof("Error while reading from socket %s, %s, %s", ls.messageType, ls.task.identifier(), err)
+				if coalescer != nil && coalescer.Pending() {
+					emit(coalescer.Flush())
+				}
 				break
 			}
 
@@ -106,9 +137,15 @@ func (ls loggingStream) listen() {
 				copy(rawMessageBytes, buffer[skipCount:readCount])
 
 				ls.logger.Debugf("This is the message we just read % 02x", rawMessageBytes)
-				logMessage := newLogMessage(rawMessageBytes)
-
-				ls.emitter.EmitLogMessage(logMessage)
+				if coalescer == nil {
+					emit(rawMessageBytes)
+				} else {
+					for _, line := range multiline.Lines(rawMessageBytes) {
+						if message := coalescer.Add(line); message != nil {
+							emit(message)
+						}
+					}
+				}
 
 				ls.logger.Debugf("Sent %d bytes to loggregator client from %s, %s", readCount-skipCount, ls.messageType, ls.task.identifier())
 			}
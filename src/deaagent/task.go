@@ -4,6 +4,7 @@ import (
 	"github.com/cloudfoundry/gosteno"
 	"github.com/cloudfoundry/loggregatorlib/emitter"
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"multiline"
 	"path/filepath"
 	"strconv"
 )
@@ -21,7 +22,7 @@ func (task task) identifier() string {
 	return filepath.Join(task.wardenContainerPath, "jobs", strconv.FormatUint(task.wardenJobId, 10))
 }
 
-func (task task) startListening(emitter emitter.Emitter, logger *gosteno.Logger) {
-	newLoggingStream(task, emitter, logger, logmessage.LogMessage_OUT).listen()
-	newLoggingStream(task, emitter, logger, logmessage.LogMessage_ERR).listen()
+func (task task) startListening(emitter emitter.Emitter, multilineConfig *multiline.Config, logger *gosteno.Logger) {
+	newLoggingStream(task, emitter, logger, logmessage.LogMessage_OUT, multilineConfig).listen()
+	newLoggingStream(task, emitter, logger, logmessage.LogMessage_ERR, multilineConfig).listen()
 }
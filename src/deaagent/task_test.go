@@ -6,6 +6,7 @@ import (
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
+	"multiline"
 	"net"
 	"os"
 	"path/filepath"
@@ -123,6 +124,39 @@ func TestThatWeHandleFourByteOffset(t *testing.T) {
 	assert.Equal(t, secondLogMessage, string(receivedMessage.GetMessage()))
 }
 
+func TestThatWeCoalesceMultiLineMessages(t *testing.T) {
+	task, tmpdir := setupTask(t, 5)
+	defer os.RemoveAll(tmpdir)
+
+	stdoutListener, stderrListener := setupSockets(t, task)
+	defer stdoutListener.Close()
+	defer stderrListener.Close()
+
+	mockLoggregatorEmitter := new(MockLoggregatorEmitter)
+	mockLoggregatorEmitter.received = make(chan *logmessage.LogMessage)
+	task.startListening(mockLoggregatorEmitter, &multiline.Config{FlushTimeoutMilliseconds: 100}, loggertesthelper.Logger())
+	receiveChannel := mockLoggregatorEmitter.received
+
+	connection, err := stdoutListener.Accept()
+	defer connection.Close()
+	assert.NoError(t, err)
+
+	_, err = connection.Write([]byte(SOCKET_PREFIX + "Exception in thread main\n\tat Foo.bar(Foo.java:12)\n"))
+	assert.NoError(t, err)
+	_, err = connection.Write([]byte("\tat Foo.main(Foo.java:3)\nSome Output\n"))
+	assert.NoError(t, err)
+
+	receivedMessage := <-receiveChannel
+	assert.Equal(t, "Exception in thread main\n\tat Foo.bar(Foo.java:12)\n\tat Foo.main(Foo.java:3)", string(receivedMessage.GetMessage()))
+
+	select {
+	case receivedMessage = <-receiveChannel:
+		assert.Equal(t, "Some Output", string(receivedMessage.GetMessage()))
+	case <-time.After(time.Second):
+		t.Error("Timed out waiting for the pending message to be flushed")
+	}
+}
+
 func TestThatWeListenToStdErrUnixSocket(t *testing.T) {
 	task, tmpdir := setupTask(t, 4)
 	defer os.RemoveAll(tmpdir)
@@ -227,7 +261,7 @@ func setupEmitter(t *testing.T, task *task, logger *gosteno.Logger) chan *logmes
 	mockLoggregatorEmitter := new(MockLoggregatorEmitter)
 
 	mockLoggregatorEmitter.received = make(chan *logmessage.LogMessage)
-	task.startListening(mockLoggregatorEmitter, logger)
+	task.startListening(mockLoggregatorEmitter, nil, logger)
 	return mockLoggregatorEmitter.received
 }
 
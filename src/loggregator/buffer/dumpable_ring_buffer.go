@@ -5,29 +5,39 @@ import (
 	"sync"
 )
 
+// DumpableRingBuffer keeps the newest messages read from its input in a
+// circular buffer of fixed capacity. Its output channel holds the same number
+// of messages and drops the oldest ones when it is full.
 type DumpableRingBuffer struct {
 	data       []*logmessage.Message
+	head       int // index of the oldest message
+	tail       int // index the next message goes to
+	count      int
 	closed     chan bool
 	outChannel chan *logmessage.Message
-	bufferSize int
+	maxBytes   int
+	byteCount  int
 	sync.RWMutex
 }
 
-func NewDumpableRingBuffer(in <-chan *logmessage.Message, bufferSize int) *DumpableRingBuffer {
-	rb := new(DumpableRingBuffer)
-	rb.bufferSize = bufferSize
-	rb.data = make([]*logmessage.Message, 0, bufferSize)
-	rb.outChannel = make(chan *logmessage.Message, bufferSize)
-
-	rb.closed = make(chan bool)
+// NewDumpableRingBuffer keeps the last bufferSize messages read from in. If
+// maxBytes is not 0 it also keeps their raw messages within maxBytes, except
+// for the newest message, which is kept however big it is. The oldest
+// messages are evicted first.
+func NewDumpableRingBuffer(in <-chan *logmessage.Message, bufferSize int, maxBytes int) *DumpableRingBuffer {
+	rb := &DumpableRingBuffer{
+		data:       make([]*logmessage.Message, bufferSize),
+		closed:     make(chan bool),
+		outChannel: make(chan *logmessage.Message, bufferSize),
+		maxBytes:   maxBytes,
+	}
 	go func() {
 		for m := range in {
 			rb.addData(m)
-			select {
-			case rb.outChannel <- m:
-			default:
-				<-rb.outChannel
-				rb.outChannel <- m
+			// Messages waiting in the input would push m out of the output
+			// channel anyway, so a reader gets the newest ones only.
+			if len(in) < cap(rb.outChannel) {
+				rb.output(m)
 			}
 		}
 		close(rb.closed)
@@ -36,10 +46,29 @@ func NewDumpableRingBuffer(in <-chan *logmessage.Message, bufferSize int) *Dumpa
 	return rb
 }
 
+// output sends m to the output channel, dropping the oldest messages in it
+// while it is full. The reader may empty the channel meanwhile, so it never
+// waits for a message to drop.
+func (r *DumpableRingBuffer) output(m *logmessage.Message) {
+	for {
+		select {
+		case r.outChannel <- m:
+			return
+		default:
+		}
+
+		select {
+		case <-r.outChannel:
+		default:
+		}
+	}
+}
+
 func (r *DumpableRingBuffer) waitForClose() {
 	<-r.closed
 }
 
+// Dump returns a copy of the retained messages, oldest first.
 func (r *DumpableRingBuffer) Dump() []*logmessage.Message {
 	return r.copyData()
 }
@@ -48,20 +77,66 @@ func (r *DumpableRingBuffer) OutputChannel() <-chan *logmessage.Message {
 	return r.outChannel
 }
 
+// Len returns the number of retained messages.
+func (r *DumpableRingBuffer) Len() int {
+	r.RLock()
+	defer r.RUnlock()
+	return r.count
+}
+
+// ByteCount returns the size of the raw retained messages.
+func (r *DumpableRingBuffer) ByteCount() int {
+	r.RLock()
+	defer r.RUnlock()
+	return r.byteCount
+}
+
+// Shrink evicts the oldest messages until the retained messages fit into
+// maxBytes and returns the number of bytes it freed.
+func (r *DumpableRingBuffer) Shrink(maxBytes int) int {
+	r.Lock()
+	defer r.Unlock()
+
+	byteCount := r.byteCount
+	for r.count > 0 && r.byteCount > maxBytes {
+		r.evictOldest()
+	}
+	return byteCount - r.byteCount
+}
+
 func (r *DumpableRingBuffer) addData(m *logmessage.Message) {
 	r.Lock()
 	defer r.Unlock()
-	if len(r.data) == r.bufferSize {
-		r.data = append(r.data[1:], m)
-	} else {
-		r.data = append(r.data, m)
+
+	if r.count == len(r.data) {
+		r.evictOldest()
+	}
+	r.data[r.tail] = m
+	r.tail = (r.tail + 1) % len(r.data)
+	r.count++
+	r.byteCount += m.GetRawMessageLength()
+
+	for r.count > 1 && r.maxBytes > 0 && r.byteCount > r.maxBytes {
+		r.evictOldest()
 	}
 }
 
+// evictOldest must be called with the lock held.
+func (r *DumpableRingBuffer) evictOldest() {
+	r.byteCount -= r.data[r.head].GetRawMessageLength()
+	r.data[r.head] = nil
+	r.head = (r.head + 1) % len(r.data)
+	r.count--
+}
+
 func (r *DumpableRingBuffer) copyData() []*logmessage.Message {
 	r.RLock()
 	defer r.RUnlock()
-	result := make([]*logmessage.Message, len(r.data))
-	copy(result, r.data)
+
+	result := make([]*logmessage.Message, r.count)
+	n := copy(result, r.data[r.head:])
+	if n < r.count {
+		copy(result[n:], r.data[:r.count-n])
+	}
 	return result
 }
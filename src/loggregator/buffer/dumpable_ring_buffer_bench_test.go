@@ -0,0 +1,181 @@
+package buffer
+
+import (
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"sync"
+	"testing"
+)
+
+// sliceRingBuffer is the DumpableRingBuffer before it became a circular
+// buffer, kept to compare the two. Unlike the original it does not wait for
+// the oldest message to drop, which deadlocks once the reader took it.
+type sliceRingBuffer struct {
+	data       []*logmessage.Message
+	outChannel chan *logmessage.Message
+	bufferSize int
+	sync.RWMutex
+}
+
+func newSliceRingBuffer(in <-chan *logmessage.Message, bufferSize int) *sliceRingBuffer {
+	rb := &sliceRingBuffer{
+		data:       make([]*logmessage.Message, 0, bufferSize),
+		outChannel: make(chan *logmessage.Message, bufferSize),
+		bufferSize: bufferSize,
+	}
+	go func() {
+		for m := range in {
+			rb.addData(m)
+			for sent := false; !sent; {
+				select {
+				case rb.outChannel <- m:
+					sent = true
+				default:
+					select {
+					case <-rb.outChannel:
+					default:
+					}
+				}
+			}
+		}
+		close(rb.outChannel)
+	}()
+	return rb
+}
+
+func (r *sliceRingBuffer) addData(m *logmessage.Message) {
+	r.Lock()
+	defer r.Unlock()
+	if len(r.data) == r.bufferSize {
+		r.data = append(r.data[1:], m)
+	} else {
+		r.data = append(r.data, m)
+	}
+}
+
+func (r *sliceRingBuffer) Dump() []*logmessage.Message {
+	r.RLock()
+	defer r.RUnlock()
+	result := make([]*logmessage.Message, len(r.data))
+	copy(result, r.data)
+	return result
+}
+
+const benchmarkBufferSize = 100
+
+func benchmarkMessage(b *testing.B) *logmessage.Message {
+	message, err := logmessage.GenerateMessage(logmessage.LogMessage_OUT, "message", "appId", "App")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return message
+}
+
+func BenchmarkDumpableRingBufferAddData(b *testing.B) {
+	message := benchmarkMessage(b)
+	buffer := NewDumpableRingBuffer(make(chan *logmessage.Message), benchmarkBufferSize, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buffer.addData(message)
+	}
+}
+
+func BenchmarkSliceRingBufferAddData(b *testing.B) {
+	message := benchmarkMessage(b)
+	buffer := newSliceRingBuffer(make(chan *logmessage.Message), benchmarkBufferSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buffer.addData(message)
+	}
+}
+
+func BenchmarkDumpableRingBufferThroughput(b *testing.B) {
+	message := benchmarkMessage(b)
+	in := make(chan *logmessage.Message)
+	buffer := NewDumpableRingBuffer(in, benchmarkBufferSize, 0)
+	go func() {
+		for _ = range buffer.OutputChannel() {
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		in <- message
+	}
+	close(in)
+}
+
+func BenchmarkSliceRingBufferThroughput(b *testing.B) {
+	message := benchmarkMessage(b)
+	in := make(chan *logmessage.Message)
+	buffer := newSliceRingBuffer(in, benchmarkBufferSize)
+	go func() {
+		for _ = range buffer.outChannel {
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		in <- message
+	}
+	close(in)
+}
+
+func BenchmarkDumpableRingBufferThroughputWithoutReader(b *testing.B) {
+	message := benchmarkMessage(b)
+	in := make(chan *logmessage.Message)
+	NewDumpableRingBuffer(in, benchmarkBufferSize, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		in <- message
+	}
+	close(in)
+}
+
+func BenchmarkSliceRingBufferThroughputWithoutReader(b *testing.B) {
+	message := benchmarkMessage(b)
+	in := make(chan *logmessage.Message)
+	newSliceRingBuffer(in, benchmarkBufferSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		in <- message
+	}
+	close(in)
+}
+
+func BenchmarkDumpableRingBufferDump(b *testing.B) {
+	message := benchmarkMessage(b)
+	buffer := NewDumpableRingBuffer(make(chan *logmessage.Message), benchmarkBufferSize, 0)
+	for i := 0; i < benchmarkBufferSize+benchmarkBufferSize/2; i++ {
+		buffer.addData(message)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buffer.Dump()
+	}
+}
+
+func BenchmarkSliceRingBufferDump(b *testing.B) {
+	message := benchmarkMessage(b)
+	buffer := newSliceRingBuffer(make(chan *logmessage.Message), benchmarkBufferSize)
+	for i := 0; i < benchmarkBufferSize+benchmarkBufferSize/2; i++ {
+		buffer.addData(message)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buffer.Dump()
+	}
+}
@@ -1,6 +1,7 @@
 package buffer
 
 import (
+	"fmt"
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
 	messagetesthelpers "github.com/cloudfoundry/loggregatorlib/logmessage/testhelpers"
 	"github.com/stretchr/testify/assert"
@@ -9,8 +10,12 @@ import (
 )
 
 func setup(bufferSize int) (chan *logmessage.Message, *DumpableRingBuffer) {
+	return setupWithMaxBytes(bufferSize, 0)
+}
+
+func setupWithMaxBytes(bufferSize int, maxBytes int) (chan *logmessage.Message, *DumpableRingBuffer) {
 	channel := make(chan *logmessage.Message, 10)
-	return channel, NewDumpableRingBuffer(channel, bufferSize)
+	return channel, NewDumpableRingBuffer(channel, bufferSize, maxBytes)
 }
 
 func TestInputChannelAddToBuffer(t *testing.T) {
@@ -44,6 +49,63 @@ func TestBufferDropsOldMessages(t *testing.T) {
 	assert.Equal(t, message2, dump[0])
 }
 
+func TestBufferDropsOldMessagesOverTheByteLimit(t *testing.T) {
+	message1 := messagetesthelpers.NewMessage(t, "message 1", "appId")
+	message2 := messagetesthelpers.NewMessage(t, "message 2", "appId")
+	message3 := messagetesthelpers.NewMessage(t, "message 3", "appId")
+	messageSize := message1.GetRawMessageLength()
+
+	channel, buffer := setupWithMaxBytes(10, 2*messageSize+1)
+	channel <- message1
+	channel <- message2
+	channel <- message3
+
+	close(channel)
+	buffer.waitForClose()
+
+	dump := buffer.Dump()
+	assert.Equal(t, 2, len(dump))
+	assert.Equal(t, message2, dump[0])
+	assert.Equal(t, message3, dump[1])
+	assert.Equal(t, 2, buffer.Len())
+	assert.Equal(t, 2*messageSize, buffer.ByteCount())
+}
+
+func TestBufferKeepsTheNewestMessageOverTheByteLimit(t *testing.T) {
+	channel, buffer := setupWithMaxBytes(10, 1)
+	message1 := messagetesthelpers.NewMessage(t, "message 1", "appId")
+	channel <- message1
+	message2 := messagetesthelpers.NewMessage(t, "message 2", "appId")
+	channel <- message2
+
+	close(channel)
+	buffer.waitForClose()
+
+	dump := buffer.Dump()
+	assert.Equal(t, 1, len(dump))
+	assert.Equal(t, message2, dump[0])
+	assert.Equal(t, message2.GetRawMessageLength(), buffer.ByteCount())
+}
+
+func TestShrinkEvictsTheOldestMessages(t *testing.T) {
+	channel, buffer := setup(10)
+	message1 := messagetesthelpers.NewMessage(t, "message 1", "appId")
+	channel <- message1
+	message2 := messagetesthelpers.NewMessage(t, "message 2", "appId")
+	channel <- message2
+
+	close(channel)
+	buffer.waitForClose()
+
+	messageSize := message1.GetRawMessageLength()
+	assert.Equal(t, messageSize, buffer.Shrink(messageSize))
+	assert.Equal(t, []*logmessage.Message{message2}, buffer.Dump())
+
+	assert.Equal(t, messageSize, buffer.Shrink(0))
+	assert.Equal(t, 0, len(buffer.Dump()))
+	assert.Equal(t, 0, buffer.ByteCount())
+}
+
 func TestBufferHasChannelListenerWithLimitOne(t *testing.T) {
 	inChannel, buffer := setup(1)
 	message1 := messagetesthelpers.NewMessage(t, "message 1", "appId")
@@ -79,3 +141,62 @@ func TestBufferHasChannelListenerWithLimitMany(t *testing.T) {
 		t.Error("OutputChannel should be closed")
 	}
 }
+
+func TestBufferKeepsTheNewestMessagesAfterWrappingAround(t *testing.T) {
+	channel, buffer := setup(3)
+	var messages []*logmessage.Message
+	for i := 0; i < 8; i++ {
+		message := messagetesthelpers.NewMessage(t, fmt.Sprintf("message %d", i), "appId")
+		messages = append(messages, message)
+		channel <- message
+	}
+
+	close(channel)
+	buffer.waitForClose()
+
+	assert.Equal(t, messages[5:], buffer.Dump())
+	assert.Equal(t, 3, buffer.Len())
+}
+
+func TestDumpIsNotAffectedByPendingOutput(t *testing.T) {
+	channel, buffer := setup(3)
+	message1 := messagetesthelpers.NewMessage(t, "message 1", "appId")
+	channel <- message1
+	message2 := messagetesthelpers.NewMessage(t, "message 2", "appId")
+	channel <- message2
+	close(channel)
+	buffer.waitForClose()
+
+	assert.Equal(t, []*logmessage.Message{message1, message2}, buffer.Dump())
+	assert.Equal(t, message1, <-buffer.OutputChannel())
+	assert.Equal(t, []*logmessage.Message{message1, message2}, buffer.Dump())
+	assert.Equal(t, message2, <-buffer.OutputChannel())
+}
+
+func TestOutputChannelDropsTheOldestMessagesWhileNobodyReads(t *testing.T) {
+	channel := make(chan *logmessage.Message)
+	buffer := NewDumpableRingBuffer(channel, 2, 0)
+	var messages []*logmessage.Message
+	for i := 0; i < 5; i++ {
+		message := messagetesthelpers.NewMessage(t, fmt.Sprintf("message %d", i), "appId")
+		messages = append(messages, message)
+		channel <- message
+	}
+	close(channel)
+
+	var output []*logmessage.Message
+	for message := range buffer.OutputChannel() {
+		output = append(output, message)
+	}
+	assert.Equal(t, messages[3:], output)
+}
+
+func TestOutputChannelIsClosedOnceTheInputIsClosed(t *testing.T) {
+	channel, buffer := setup(3)
+	close(channel)
+	buffer.waitForClose()
+
+	_, ok := <-buffer.OutputChannel()
+	assert.False(t, ok)
+	assert.Equal(t, 0, len(buffer.Dump()))
+}
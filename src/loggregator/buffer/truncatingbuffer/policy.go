@@ -0,0 +1,51 @@
+package truncatingbuffer
+
+import (
+	"fmt"
+	"time"
+)
+
+// The policies a truncating buffer overflows with.
+const (
+	// Reset drops all buffered messages and tells the app how many were
+	// lost.
+	Reset = "reset"
+	// DropOldest drops the oldest buffered message for every new one.
+	DropOldest = "drop-oldest"
+	// DropNewest drops new messages until there is room again.
+	DropNewest = "drop-newest"
+	// Block waits for room for up to the block timeout before dropping the
+	// new message.
+	Block = "block"
+)
+
+// Policy tells a truncating buffer what to do when it is full.
+type Policy struct {
+	Name         string
+	BlockTimeout time.Duration
+}
+
+// NewPolicy creates the overflow policy with the given name. The empty name
+// selects Reset. blockTimeout only applies to Block.
+func NewPolicy(name string, blockTimeout time.Duration) (Policy, error) {
+	switch name {
+	case Reset, "":
+		return Policy{Name: Reset}, nil
+	case DropOldest, DropNewest:
+		return Policy{Name: name}, nil
+	case Block:
+		if blockTimeout <= 0 {
+			return Policy{}, fmt.Errorf("Overflow policy %s needs a positive timeout", name)
+		}
+		return Policy{Name: name, BlockTimeout: blockTimeout}, nil
+	}
+	return Policy{}, fmt.Errorf("Unknown overflow policy: %s", name)
+}
+
+// String returns the name of the policy, reset for the zero Policy.
+func (p Policy) String() string {
+	if p.Name == "" {
+		return Reset
+	}
+	return p.Name
+}
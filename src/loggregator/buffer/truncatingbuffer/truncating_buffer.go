@@ -6,20 +6,33 @@ import (
 	"github.com/cloudfoundry/gosteno"
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
 	"loggregator/buffer"
+	"loggregator/dropcounter"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type truncatingBuffer struct {
-	inputChannel  <-chan *logmessage.Message
-	outputChannel chan *logmessage.Message
-	logger        *gosteno.Logger
-	lock          *sync.RWMutex
+	inputChannel        <-chan *logmessage.Message
+	outputChannel       chan *logmessage.Message
+	policy              Policy
+	droppedMessageCount *uint64
+	appDroppedMessages  *dropcounter.Counter
+	logger              *gosteno.Logger
+	lock                *sync.RWMutex
 }
 
-func NewTruncatingBuffer(inputChannel <-chan *logmessage.Message, bufferSize uint, logger *gosteno.Logger) buffer.MessageBuffer {
+// NewTruncatingBuffer creates a buffer of bufferSize messages that handles
+// overflows as told by policy, the zero Policy being Reset. The number of
+// messages it drops is added to droppedMessageCount, if not nil, and per app
+// to appDroppedMessages. Without appDroppedMessages, Reset tells the app
+// about the dropped messages in the stream itself.
+func NewTruncatingBuffer(inputChannel <-chan *logmessage.Message, bufferSize uint, policy Policy, droppedMessageCount *uint64, appDroppedMessages *dropcounter.Counter, logger *gosteno.Logger) buffer.MessageBuffer {
 	outputChannel := make(chan *logmessage.Message, bufferSize)
-	return &truncatingBuffer{inputChannel, outputChannel, logger, &sync.RWMutex{}}
+	if droppedMessageCount == nil {
+		droppedMessageCount = new(uint64)
+	}
+	return &truncatingBuffer{inputChannel, outputChannel, policy, droppedMessageCount, appDroppedMessages, logger, &sync.RWMutex{}}
 }
 
 func (r *truncatingBuffer) GetOutputChannel() <-chan *logmessage.Message {
@@ -33,31 +46,110 @@ func (r *truncatingBuffer) CloseOutputChannel() {
 	close(r.outputChannel)
 }
 
+// Run moves messages from the input to the output channel. Only Run
+// replaces the output channel, so it reads it without taking the lock.
 func (r *truncatingBuffer) Run() {
 	for v := range r.inputChannel {
-		r.lock.Lock()
 		select {
 		case r.outputChannel <- v:
+			continue
 		default:
-			messageCount := len(r.outputChannel)
-			r.outputChannel = make(chan *logmessage.Message, cap(r.outputChannel))
-			lm := generateLogMessage(fmt.Sprintf("Log message output too high. We've dropped %d messages", messageCount), v.GetLogMessage().AppId)
-			lmBytes, err := proto.Marshal(lm)
-			if err != nil {
-				r.logger.Error("TB: Output channel too full. And we failed to notify them. Dropping Buffer.")
-				continue
-			}
-			r.outputChannel <- logmessage.NewMessage(lm, lmBytes)
-			r.outputChannel <- v
-			if r.logger != nil {
-				r.logger.Warn("TB: Output channel too full. Dropped Buffer.")
-			}
 		}
-		r.lock.Unlock()
+
+		switch r.policy.String() {
+		case DropOldest:
+			r.dropOldest(v)
+		case DropNewest:
+			r.drop(v, 1)
+			r.debug("TB: Output channel too full. Dropped newest message.")
+		case Block:
+			r.block(v)
+		default:
+			r.reset(v)
+		}
 	}
 	close(r.outputChannel)
 }
 
+func (r *truncatingBuffer) reset(v *logmessage.Message) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	messageCount := len(r.outputChannel)
+	r.outputChannel = make(chan *logmessage.Message, cap(r.outputChannel))
+	r.drop(v, messageCount)
+
+	if r.appDroppedMessages != nil {
+		// The app hears about the drops from the counter's notices.
+		r.outputChannel <- v
+		if r.logger != nil {
+			r.logger.Warn("TB: Output channel too full. Dropped Buffer.")
+		}
+		return
+	}
+
+	lm := generateLogMessage(fmt.Sprintf("Log message output too high. We've dropped %d messages", messageCount), v.GetLogMessage().AppId)
+	lmBytes, err := proto.Marshal(lm)
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("TB: Output channel too full. And we failed to notify them. Dropping Buffer.")
+		}
+		r.outputChannel <- v
+		return
+	}
+	r.outputChannel <- logmessage.NewMessage(lm, lmBytes)
+	r.outputChannel <- v
+	if r.logger != nil {
+		r.logger.Warn("TB: Output channel too full. Dropped Buffer.")
+	}
+}
+
+// dropOldest makes room for v by dropping the oldest messages. The reader
+// may empty the channel meanwhile, so it only drops while the channel is
+// still full.
+func (r *truncatingBuffer) dropOldest(v *logmessage.Message) {
+	for {
+		select {
+		case oldest := <-r.outputChannel:
+			r.drop(oldest, 1)
+			r.debug("TB: Output channel too full. Dropped oldest message.")
+		default:
+		}
+
+		select {
+		case r.outputChannel <- v:
+			return
+		default:
+		}
+	}
+}
+
+func (r *truncatingBuffer) block(v *logmessage.Message) {
+	timer := time.NewTimer(r.policy.BlockTimeout)
+	defer timer.Stop()
+
+	select {
+	case r.outputChannel <- v:
+	case <-timer.C:
+		r.drop(v, 1)
+		r.debug("TB: Output channel stayed full. Dropped newest message.")
+	}
+}
+
+// drop counts messageCount dropped messages of the app v belongs to.
+func (r *truncatingBuffer) drop(v *logmessage.Message, messageCount int) {
+	atomic.AddUint64(r.droppedMessageCount, uint64(messageCount))
+	r.appDroppedMessages.Add(v.GetLogMessage().GetAppId(), uint64(messageCount))
+}
+
+// debug logs single dropped messages, which would flood the log at warn
+// level during a burst.
+func (r *truncatingBuffer) debug(message string) {
+	if r.logger != nil {
+		r.logger.Debug(message)
+	}
+}
+
 func generateLogMessage(messageString string, appId *string) *logmessage.LogMessage {
 	messageType := logmessage.LogMessage_ERR
 	currentTime := time.Now()
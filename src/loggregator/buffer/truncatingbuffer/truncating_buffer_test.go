@@ -4,13 +4,15 @@ import (
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
 	messagetesthelpers "github.com/cloudfoundry/loggregatorlib/logmessage/testhelpers"
 	"github.com/stretchr/testify/assert"
+	"loggregator/dropcounter"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestThatItWorksLikeAChannel(t *testing.T) {
 	inMessageChan := make(chan *logmessage.Message)
-	buffer := NewTruncatingBuffer(inMessageChan, 2, nil)
+	buffer := NewTruncatingBuffer(inMessageChan, 2, Policy{}, nil, nil, nil)
 	go buffer.Run()
 
 	logMessage1 := messagetesthelpers.NewMessage(t, "message 1", "appId")
@@ -26,7 +28,7 @@ func TestThatItWorksLikeAChannel(t *testing.T) {
 
 func TestThatItWorksLikeATruncatingChannel(t *testing.T) {
 	inMessageChan := make(chan *logmessage.Message)
-	buffer := NewTruncatingBuffer(inMessageChan, 2, nil)
+	buffer := NewTruncatingBuffer(inMessageChan, 2, Policy{}, nil, nil, nil)
 	go buffer.Run()
 
 	logMessage1 := messagetesthelpers.NewMessage(t, "message 1", "appId")
@@ -46,3 +48,146 @@ func TestThatItWorksLikeATruncatingChannel(t *testing.T) {
 	assert.Contains(t, string(readMessage2.GetRawMessage()), "message 3")
 
 }
+
+func TestThatResetCountsTheDroppedMessages(t *testing.T) {
+	inMessageChan := make(chan *logmessage.Message)
+	dropped := new(uint64)
+	buffer := NewTruncatingBuffer(inMessageChan, 2, Policy{Name: Reset}, dropped, nil, nil)
+	go buffer.Run()
+
+	for _, message := range []string{"message 1", "message 2", "message 3"} {
+		inMessageChan <- messagetesthelpers.NewMessage(t, message, "appId")
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Equal(t, uint64(2), atomic.LoadUint64(dropped))
+}
+
+func TestThatDropOldestDropsOneMessageAtATime(t *testing.T) {
+	inMessageChan := make(chan *logmessage.Message)
+	dropped := new(uint64)
+	buffer := NewTruncatingBuffer(inMessageChan, 2, Policy{Name: DropOldest}, dropped, nil, nil)
+	go buffer.Run()
+
+	for _, message := range []string{"message 1", "message 2", "message 3", "message 4"} {
+		inMessageChan <- messagetesthelpers.NewMessage(t, message, "appId")
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	readMessage := <-buffer.GetOutputChannel()
+	assert.Contains(t, string(readMessage.GetRawMessage()), "message 3")
+
+	readMessage2 := <-buffer.GetOutputChannel()
+	assert.Contains(t, string(readMessage2.GetRawMessage()), "message 4")
+
+	assert.Equal(t, uint64(2), atomic.LoadUint64(dropped))
+}
+
+func TestThatDropNewestKeepsTheBufferedMessages(t *testing.T) {
+	inMessageChan := make(chan *logmessage.Message)
+	dropped := new(uint64)
+	buffer := NewTruncatingBuffer(inMessageChan, 2, Policy{Name: DropNewest}, dropped, nil, nil)
+	go buffer.Run()
+
+	for _, message := range []string{"message 1", "message 2", "message 3"} {
+		inMessageChan <- messagetesthelpers.NewMessage(t, message, "appId")
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	readMessage := <-buffer.GetOutputChannel()
+	assert.Contains(t, string(readMessage.GetRawMessage()), "message 1")
+
+	readMessage2 := <-buffer.GetOutputChannel()
+	assert.Contains(t, string(readMessage2.GetRawMessage()), "message 2")
+
+	assert.Equal(t, uint64(1), atomic.LoadUint64(dropped))
+}
+
+func TestThatDropsAreCountedPerApp(t *testing.T) {
+	inMessageChan := make(chan *logmessage.Message)
+	appDroppedMessages := dropcounter.New("truncatingBuffer", 10)
+	buffer := NewTruncatingBuffer(inMessageChan, 1, Policy{Name: DropOldest}, nil, appDroppedMessages, nil)
+	go buffer.Run()
+
+	for _, message := range []string{"message 1", "message 2", "message 3"} {
+		inMessageChan <- messagetesthelpers.NewMessage(t, message, "appId")
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Equal(t, uint64(2), appDroppedMessages.Count("appId"))
+}
+
+func TestThatResetLeavesTheNoticeToTheDropCounter(t *testing.T) {
+	inMessageChan := make(chan *logmessage.Message)
+	appDroppedMessages := dropcounter.New("truncatingBuffer", 10)
+	buffer := NewTruncatingBuffer(inMessageChan, 2, Policy{Name: Reset}, nil, appDroppedMessages, nil)
+	go buffer.Run()
+
+	for _, message := range []string{"message 1", "message 2", "message 3"} {
+		inMessageChan <- messagetesthelpers.NewMessage(t, message, "appId")
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	readMessage := <-buffer.GetOutputChannel()
+	assert.Contains(t, string(readMessage.GetRawMessage()), "message 3")
+	assert.Equal(t, uint64(2), appDroppedMessages.Count("appId"))
+}
+
+func TestThatBlockWaitsForRoom(t *testing.T) {
+	inMessageChan := make(chan *logmessage.Message)
+	dropped := new(uint64)
+	buffer := NewTruncatingBuffer(inMessageChan, 2, Policy{Name: Block, BlockTimeout: time.Second}, dropped, nil, nil)
+	go buffer.Run()
+
+	for _, message := range []string{"message 1", "message 2", "message 3"} {
+		inMessageChan <- messagetesthelpers.NewMessage(t, message, "appId")
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	for _, message := range []string{"message 1", "message 2", "message 3"} {
+		readMessage := <-buffer.GetOutputChannel()
+		assert.Contains(t, string(readMessage.GetRawMessage()), message)
+	}
+
+	assert.Equal(t, uint64(0), atomic.LoadUint64(dropped))
+}
+
+func TestThatBlockDropsTheNewestMessageAfterTheTimeout(t *testing.T) {
+	inMessageChan := make(chan *logmessage.Message)
+	dropped := new(uint64)
+	buffer := NewTruncatingBuffer(inMessageChan, 2, Policy{Name: Block, BlockTimeout: 10 * time.Millisecond}, dropped, nil, nil)
+	go buffer.Run()
+
+	for _, message := range []string{"message 1", "message 2", "message 3"} {
+		inMessageChan <- messagetesthelpers.NewMessage(t, message, "appId")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	readMessage := <-buffer.GetOutputChannel()
+	assert.Contains(t, string(readMessage.GetRawMessage()), "message 1")
+
+	readMessage2 := <-buffer.GetOutputChannel()
+	assert.Contains(t, string(readMessage2.GetRawMessage()), "message 2")
+
+	assert.Equal(t, uint64(1), atomic.LoadUint64(dropped))
+}
+
+func TestNewPolicy(t *testing.T) {
+	policy, err := NewPolicy("", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, Reset, policy.Name)
+
+	policy, err = NewPolicy(DropOldest, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, DropOldest, policy.Name)
+
+	policy, err = NewPolicy(Block, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, Policy{Name: Block, BlockTimeout: time.Second}, policy)
+
+	_, err = NewPolicy(Block, 0)
+	assert.Equal(t, "Overflow policy block needs a positive timeout", err.Error())
+
+	_, err = NewPolicy("drop-everything", 0)
+	assert.Equal(t, "Unknown overflow policy: drop-everything", err.Error())
+}
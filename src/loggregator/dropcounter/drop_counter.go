@@ -0,0 +1,149 @@
+package dropcounter
+
+import (
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"sort"
+	"sync"
+)
+
+// AppCount is the number of messages dropped for one app.
+type AppCount struct {
+	AppId string
+	Count uint64
+}
+
+// Counter counts the messages dropped at one point of the pipeline, per
+// app. All methods of a nil Counter do nothing.
+type Counter struct {
+	name         string
+	topOffenders int
+	total        uint64
+	counts       map[string]uint64
+	pending      map[string]uint64
+	sync.Mutex
+}
+
+// New creates a counter that is emitted as name and reports the
+// topOffenders apps with the most dropped messages.
+func New(name string, topOffenders int) *Counter {
+	return &Counter{
+		name:         name,
+		topOffenders: topOffenders,
+		counts:       make(map[string]uint64),
+		pending:      make(map[string]uint64),
+	}
+}
+
+// Add records that count messages of the app were dropped.
+func (c *Counter) Add(appId string, count uint64) {
+	if c == nil || count == 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.total += count
+	c.counts[appId] += count
+	c.pending[appId] += count
+}
+
+// Count returns the number of messages of the app dropped so far.
+func (c *Counter) Count(appId string) uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.counts[appId]
+}
+
+// Forget drops what was counted for the app, e.g. once it is gone. Total
+// keeps including its messages.
+func (c *Counter) Forget(appId string) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.counts, appId)
+	delete(c.pending, appId)
+}
+
+// Total returns the number of messages of all apps dropped so far.
+func (c *Counter) Total() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.total
+}
+
+// TopOffenders returns the apps with the most dropped messages, most first.
+func (c *Counter) TopOffenders() []AppCount {
+	if c == nil {
+		return nil
+	}
+
+	c.Lock()
+	appCounts := make([]AppCount, 0, len(c.counts))
+	for appId, count := range c.counts {
+		appCounts = append(appCounts, AppCount{appId, count})
+	}
+	c.Unlock()
+
+	sort.Sort(byCount(appCounts))
+	if len(appCounts) > c.topOffenders {
+		appCounts = appCounts[:c.topOffenders]
+	}
+	return appCounts
+}
+
+// TakePending returns the messages dropped per app since the last call.
+func (c *Counter) TakePending() map[string]uint64 {
+	if c == nil {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	pending := c.pending
+	c.pending = make(map[string]uint64)
+	return pending
+}
+
+func (c *Counter) Emit() instrumentation.Context {
+	if c == nil {
+		return instrumentation.Context{}
+	}
+
+	metrics := []instrumentation.Metric{
+		instrumentation.Metric{Name: "droppedMessageCount", Value: c.Total()},
+	}
+	for _, appCount := range c.TopOffenders() {
+		metrics = append(metrics, instrumentation.Metric{Name: "droppedMessageCount:" + appCount.AppId, Value: appCount.Count})
+	}
+
+	return instrumentation.Context{Name: c.name,
+		Metrics: metrics,
+	}
+}
+
+type byCount []AppCount
+
+func (a byCount) Len() int      { return len(a) }
+func (a byCount) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byCount) Less(i, j int) bool {
+	if a[i].Count != a[j].Count {
+		return a[i].Count > a[j].Count
+	}
+	return a[i].AppId < a[j].AppId
+}
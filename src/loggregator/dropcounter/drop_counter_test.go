@@ -0,0 +1,72 @@
+package dropcounter
+
+import (
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCountsDroppedMessagesPerApp(t *testing.T) {
+	counter := New("test", 10)
+	counter.Add("app1", 2)
+	counter.Add("app2", 1)
+	counter.Add("app1", 3)
+
+	assert.Equal(t, uint64(5), counter.Count("app1"))
+	assert.Equal(t, uint64(1), counter.Count("app2"))
+	assert.Equal(t, uint64(0), counter.Count("app3"))
+	assert.Equal(t, uint64(6), counter.Total())
+}
+
+func TestReportsTheTopOffenders(t *testing.T) {
+	counter := New("test", 2)
+	counter.Add("app1", 1)
+	counter.Add("app2", 5)
+	counter.Add("app3", 3)
+	counter.Add("app4", 3)
+
+	assert.Equal(t, []AppCount{{"app2", 5}, {"app3", 3}}, counter.TopOffenders())
+
+	context := counter.Emit()
+	assert.Equal(t, "test", context.Name)
+	assert.Equal(t, []instrumentation.Metric{
+		instrumentation.Metric{Name: "droppedMessageCount", Value: uint64(12)},
+		instrumentation.Metric{Name: "droppedMessageCount:app2", Value: uint64(5)},
+		instrumentation.Metric{Name: "droppedMessageCount:app3", Value: uint64(3)},
+	}, context.Metrics)
+}
+
+func TestTakePendingReturnsTheDropsSinceTheLastCall(t *testing.T) {
+	counter := New("test", 10)
+	counter.Add("app1", 2)
+	counter.Add("app2", 1)
+
+	assert.Equal(t, map[string]uint64{"app1": 2, "app2": 1}, counter.TakePending())
+	assert.Equal(t, 0, len(counter.TakePending()))
+
+	counter.Add("app1", 1)
+	assert.Equal(t, map[string]uint64{"app1": 1}, counter.TakePending())
+	assert.Equal(t, uint64(3), counter.Count("app1"))
+}
+
+func TestForgetDropsTheCountsOfAnApp(t *testing.T) {
+	counter := New("test", 10)
+	counter.Add("app1", 2)
+	counter.Add("app2", 1)
+	counter.Forget("app1")
+
+	assert.Equal(t, uint64(0), counter.Count("app1"))
+	assert.Equal(t, []AppCount{{"app2", 1}}, counter.TopOffenders())
+	assert.Equal(t, map[string]uint64{"app2": 1}, counter.TakePending())
+	assert.Equal(t, uint64(3), counter.Total())
+}
+
+func TestNilCounterDoesNothing(t *testing.T) {
+	var counter *Counter
+	counter.Add("app1", 1)
+	counter.Forget("app1")
+
+	assert.Equal(t, uint64(0), counter.Count("app1"))
+	assert.Equal(t, 0, len(counter.TakePending()))
+	assert.Equal(t, 0, len(counter.TopOffenders()))
+}
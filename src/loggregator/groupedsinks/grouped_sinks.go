@@ -49,8 +49,7 @@ func (gc *GroupedSinks) DrainsFor(appId string) (results []sinks.Sink) {
 	defer gc.RUnlock()
 
 	for _, s := range gc.apps[appId] {
-		_, isSyslogSink := s.(*sinks.SyslogSink)
-		if isSyslogSink {
+		if _, isDrain := s.(sinks.Drain); isDrain {
 			results = append(results, s)
 		}
 	}
@@ -58,6 +57,34 @@ func (gc *GroupedSinks) DrainsFor(appId string) (results []sinks.Sink) {
 	return results
 }
 
+func (gc *GroupedSinks) AllDrains() (results []sinks.Sink) {
+	gc.RLock()
+	defer gc.RUnlock()
+
+	for _, appSinks := range gc.apps {
+		for _, s := range appSinks {
+			if _, isDrain := s.(sinks.Drain); isDrain {
+				results = append(results, s)
+			}
+		}
+	}
+
+	return results
+}
+
+func (gc *GroupedSinks) AllDumps() (results []*sinks.DumpSink) {
+	gc.RLock()
+	defer gc.RUnlock()
+
+	for appId, appSinks := range gc.apps {
+		if dump, ok := appSinks[appId].(*sinks.DumpSink); ok {
+			results = append(results, dump)
+		}
+	}
+
+	return results
+}
+
 func (gc *GroupedSinks) DumpFor(appId string) *sinks.DumpSink {
 	gc.RLock()
 	defer gc.RUnlock()
@@ -31,25 +31,55 @@ func ValidateIpAddresses(ranges []IPRange) error {
 	return nil
 }
 
+// IpOutsideOfRanges reports whether the host of testURL is outside of all
+// ranges. Host names are resolved and every address they resolve to has to
+// be outside of the ranges.
 func IpOutsideOfRanges(testURL url.URL, ranges []IPRange) (bool, error) {
 	if len(testURL.Host) == 0 {
 		return false, errors.New(fmt.Sprintf("Incomplete URL %s. "+
 			"This could be caused by an URL without slashes or protocol.", testURL))
 	}
 	host := strings.Split(testURL.Host, ":")[0]
-	ipAddress := net.ParseIP(host)
-	if ipAddress == nil {
-		ipAddr, err := net.ResolveIPAddr("ip", host)
-		if err != nil {
-			return false, errors.New(fmt.Sprintf("Resolving host failed: %s", err))
+	ipAddresses, err := ResolveHost(host)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ipAddress := range ipAddresses {
+		if IpInRanges(ipAddress, ranges) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ResolveHost returns all IP addresses of host, which may also be an IP
+// address itself.
+func ResolveHost(host string) ([]net.IP, error) {
+	if ipAddress := net.ParseIP(host); ipAddress != nil {
+		return []net.IP{ipAddress}, nil
+	}
+
+	addresses, err := net.LookupHost(host)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Resolving host failed: %s", err))
+	}
+	ipAddresses := make([]net.IP, 0, len(addresses))
+	for _, address := range addresses {
+		if ipAddress := net.ParseIP(address); ipAddress != nil {
+			ipAddresses = append(ipAddresses, ipAddress)
 		}
-		ipAddress = net.ParseIP(ipAddr.String())
 	}
+	return ipAddresses, nil
+}
 
+// IpInRanges reports whether ipAddress is in one of the ranges.
+func IpInRanges(ipAddress net.IP, ranges []IPRange) bool {
+	ipAddress = ipAddress.To16()
 	for _, ipRange := range ranges {
 		if bytes.Compare(ipAddress, net.ParseIP(ipRange.Start)) >= 0 && bytes.Compare(ipAddress, net.ParseIP(ipRange.End)) <= 0 {
-			return false, nil
+			return true
 		}
 	}
-	return true, nil
+	return false
 }
@@ -3,6 +3,7 @@ package iprange
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"net"
 	"net/url"
 	"testing"
 )
@@ -137,3 +138,22 @@ func TestResolvesIpAddresses(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "Resolving host failed: ")
 }
+
+func TestIpInRanges(t *testing.T) {
+	ranges := []IPRange{IPRange{Start: "10.0.0.1", End: "10.0.0.9"}}
+
+	assert.True(t, IpInRanges(net.ParseIP("10.0.0.5"), ranges))
+	assert.True(t, IpInRanges(net.ParseIP("10.0.0.5").To4(), ranges))
+	assert.False(t, IpInRanges(net.ParseIP("10.0.0.10"), ranges))
+	assert.False(t, IpInRanges(net.ParseIP("::1"), ranges))
+}
+
+func TestResolveHost(t *testing.T) {
+	ipAddresses, err := ResolveHost("10.0.0.5")
+	assert.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("10.0.0.5")}, ipAddresses)
+
+	ipAddresses, err = ResolveHost("localhost")
+	assert.NoError(t, err)
+	assert.True(t, len(ipAddresses) > 0)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"flag"
 	"fmt"
@@ -10,26 +12,101 @@ import (
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/registrars/collectorregistrar"
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"io/ioutil"
+	"loggregator/buffer/truncatingbuffer"
 	"loggregator/iprange"
+	"loggregator/redaction"
+	"loggregator/sinks"
+	"loggregator/sinks/retrystrategy"
+	"loggregator/sinks/spool"
+	"loggregator/sinks/syslogwriter"
 	"loggregator/sinkserver"
 	"math/rand"
 	"os"
 	"os/signal"
 	"runtime"
+	"syscall"
 	"time"
 )
 
 type Config struct {
 	cfcomponent.Config
-	Index                  uint
-	IncomingPort           uint32
-	OutgoingPort           uint32
-	LogFilePath            string
-	MaxRetainedLogMessages int
-	WSMessageBufferSize    uint
-	SharedSecret           string
-	SkipCertVerify         bool
-	BlackListIps           []iprange.IPRange
+	Index                   uint
+	IncomingPort            uint32
+	OutgoingPort            uint32
+	LogFilePath             string
+	MaxRetainedLogMessages  int
+	MaxRetainedLogBytes     int
+	RecentLogBudgetBytes    int
+	WSMessageBufferSize     uint
+	SharedSecret            string
+	SkipCertVerify          bool
+	BlackListIps            []iprange.IPRange
+	DrainSpoolDirectory     string
+	DrainSpoolMaxBytes      int64
+	DrainSpoolMaxAgeSeconds int
+	DrainStatusPort         uint32
+
+	DrainCircuitBreakerMaxFailures       int
+	DrainCircuitBreakerMaxFailureSeconds int
+	DrainCircuitBreakerProbeSeconds      int
+
+	DrainRetryStrategy        string
+	DrainRetryMaxDelaySeconds int
+	DrainRetryIntervalSeconds int
+
+	DrainMessageRateLimit    float64
+	DrainByteRateLimit       float64
+	AppDrainMessageRateLimit float64
+	AppDrainByteRateLimit    float64
+
+	DrainDNSTTLSeconds       int
+	DrainWriteTimeoutSeconds int
+
+	// Syslog drains over TLS present the client certificate in
+	// DrainTLSCertFile and DrainTLSKeyFile and verify drains against the CA
+	// bundle in DrainTLSCAFile. Drain URLs of the apps listed with them may
+	// pick others by their name in DrainTLSClientCertificates and
+	// DrainTLSCABundles.
+	DrainTLSCertFile           string
+	DrainTLSKeyFile            string
+	DrainTLSCAFile             string
+	DrainTLSClientCertificates map[string]KeyPairFiles
+	DrainTLSCABundles          map[string]CABundleFile
+
+	// The RFC5424 header fields of syslog drains, see syslogwriter.Header.
+	DrainSyslogHostname       string
+	DrainSyslogFacility       string
+	DrainSyslogAppName        string
+	DrainSyslogStructuredData bool
+
+	// The truncatingbuffer policies the message buffers of websocket,
+	// syslog and HTTPS sinks overflow with. The block policy waits for up
+	// to OverflowBlockTimeoutMilliseconds, holding up the messages of all
+	// apps meanwhile, and is not available for websocket sinks.
+	WSMessageOverflowPolicy          string
+	DrainSyslogOverflowPolicy        string
+	DrainHttpsOverflowPolicy         string
+	OverflowBlockTimeoutMilliseconds int
+
+	// The recent logs are saved to RecentLogSnapshotFile on shutdown and
+	// restored from it on startup, except for messages older than
+	// RecentLogSnapshotMaxAgeSeconds.
+	RecentLogSnapshotFile          string
+	RecentLogSnapshotMaxAgeSeconds int
+
+	RedactionRules []redaction.Rule
+}
+
+type KeyPairFiles struct {
+	CertFile string
+	KeyFile  string
+	AppIds   []string
+}
+
+type CABundleFile struct {
+	File   string
+	AppIds []string
 }
 
 func (c *Config) validate(logger *gosteno.Logger) (err error) {
@@ -37,6 +114,14 @@ func (c *Config) validate(logger *gosteno.Logger) (err error) {
 		return errors.New("Need max number of log messages to retain per application")
 	}
 
+	if c.MaxRetainedLogBytes < 0 || c.RecentLogBudgetBytes < 0 {
+		return errors.New("MaxRetainedLogBytes and RecentLogBudgetBytes must not be negative")
+	}
+
+	if c.RecentLogSnapshotMaxAgeSeconds < 0 {
+		return errors.New("RecentLogSnapshotMaxAgeSeconds must not be negative")
+	}
+
 	if c.BlackListIps != nil {
 		err = iprange.ValidateIpAddresses(c.BlackListIps)
 		if err != nil {
@@ -44,10 +129,148 @@ func (c *Config) validate(logger *gosteno.Logger) (err error) {
 		}
 	}
 
+	if c.DrainSpoolDirectory != "" && c.DrainSpoolMaxBytes <= 0 {
+		return errors.New("Need a positive DrainSpoolMaxBytes when DrainSpoolDirectory is set")
+	}
+
+	if c.DrainMessageRateLimit < 0 || c.DrainByteRateLimit < 0 || c.AppDrainMessageRateLimit < 0 || c.AppDrainByteRateLimit < 0 {
+		return errors.New("Drain rate limits must not be negative")
+	}
+
+	circuitBreakerEnabled := c.DrainCircuitBreakerMaxFailures > 0 || c.DrainCircuitBreakerMaxFailureSeconds > 0
+	if circuitBreakerEnabled && c.DrainCircuitBreakerProbeSeconds <= 0 {
+		return errors.New("Need a positive DrainCircuitBreakerProbeSeconds when the drain circuit breaker is enabled")
+	}
+
+	_, err = redaction.NewRedactor(c.RedactionRules)
+	if err != nil {
+		return err
+	}
+
+	if (c.DrainTLSCertFile == "") != (c.DrainTLSKeyFile == "") {
+		return errors.New("Need both DrainTLSCertFile and DrainTLSKeyFile for a drain client certificate")
+	}
+
+	_, err = retrystrategy.New(c.DrainRetryStrategy, time.Duration(c.DrainRetryMaxDelaySeconds)*time.Second, time.Duration(c.DrainRetryIntervalSeconds)*time.Second)
+	if err != nil {
+		return err
+	}
+
+	if c.WSMessageOverflowPolicy == truncatingbuffer.Block {
+		return errors.New("WSMessageOverflowPolicy must not be block, slow websocket clients would hold up all apps")
+	}
+	for _, name := range []string{c.WSMessageOverflowPolicy, c.DrainSyslogOverflowPolicy, c.DrainHttpsOverflowPolicy} {
+		_, err = c.overflowPolicy(name)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = c.Validate(logger)
 	return
 }
 
+// drainConfig returns the settings of the drains, loading their TLS
+// certificates and CA bundles.
+func (c *Config) drainConfig() (sinks.DrainConfig, error) {
+	drainConfig := sinks.DrainConfig{
+		SkipCertVerify: c.SkipCertVerify,
+		SpoolDirectory: c.DrainSpoolDirectory,
+		SpoolMaxSize:   c.DrainSpoolMaxBytes,
+		SpoolMaxAge:    time.Duration(c.DrainSpoolMaxAgeSeconds) * time.Second,
+
+		CircuitBreakerMaxFailures:        c.DrainCircuitBreakerMaxFailures,
+		CircuitBreakerMaxFailureDuration: time.Duration(c.DrainCircuitBreakerMaxFailureSeconds) * time.Second,
+		CircuitBreakerProbeInterval:      time.Duration(c.DrainCircuitBreakerProbeSeconds) * time.Second,
+
+		RetryStrategy: c.DrainRetryStrategy,
+		RetryMaxDelay: time.Duration(c.DrainRetryMaxDelaySeconds) * time.Second,
+		RetryInterval: time.Duration(c.DrainRetryIntervalSeconds) * time.Second,
+
+		MessageRateLimit:    c.DrainMessageRateLimit,
+		ByteRateLimit:       c.DrainByteRateLimit,
+		AppMessageRateLimit: c.AppDrainMessageRateLimit,
+		AppByteRateLimit:    c.AppDrainByteRateLimit,
+
+		DNSTTL:       time.Duration(c.DrainDNSTTLSeconds) * time.Second,
+		WriteTimeout: time.Duration(c.DrainWriteTimeoutSeconds) * time.Second,
+
+		SyslogOverflowPolicy: c.DrainSyslogOverflowPolicy,
+		HttpsOverflowPolicy:  c.DrainHttpsOverflowPolicy,
+		OverflowBlockTimeout: c.overflowBlockTimeout(),
+
+		SyslogHeader: syslogwriter.Header{
+			Hostname:       c.DrainSyslogHostname,
+			AppName:        c.DrainSyslogAppName,
+			StructuredData: c.DrainSyslogStructuredData,
+		},
+	}
+
+	if c.DrainSyslogFacility != "" {
+		facility, err := syslogwriter.ParseFacility(c.DrainSyslogFacility)
+		if err != nil {
+			return drainConfig, err
+		}
+		drainConfig.SyslogHeader.Facility = facility
+	}
+
+	if c.DrainTLSCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(c.DrainTLSCertFile, c.DrainTLSKeyFile)
+		if err != nil {
+			return drainConfig, err
+		}
+		drainConfig.ClientCertificate = &certificate
+	}
+
+	if c.DrainTLSCAFile != "" {
+		rootCAs, err := loadCertPool(c.DrainTLSCAFile)
+		if err != nil {
+			return drainConfig, err
+		}
+		drainConfig.RootCAs = rootCAs
+	}
+
+	drainConfig.ClientCertificates = make(map[string]sinks.TLSClientCertificate)
+	for name, files := range c.DrainTLSClientCertificates {
+		certificate, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return drainConfig, fmt.Errorf("Invalid drain client certificate %s: %v", name, err)
+		}
+		drainConfig.ClientCertificates[name] = sinks.TLSClientCertificate{Certificate: certificate, AppIds: files.AppIds}
+	}
+
+	drainConfig.CABundles = make(map[string]sinks.TLSCABundle)
+	for name, bundle := range c.DrainTLSCABundles {
+		rootCAs, err := loadCertPool(bundle.File)
+		if err != nil {
+			return drainConfig, fmt.Errorf("Invalid drain CA bundle %s: %v", name, err)
+		}
+		drainConfig.CABundles[name] = sinks.TLSCABundle{RootCAs: rootCAs, AppIds: bundle.AppIds}
+	}
+
+	return drainConfig, nil
+}
+
+func (c *Config) overflowPolicy(name string) (truncatingbuffer.Policy, error) {
+	return truncatingbuffer.NewPolicy(name, c.overflowBlockTimeout())
+}
+
+func (c *Config) overflowBlockTimeout() time.Duration {
+	return time.Duration(c.OverflowBlockTimeoutMilliseconds) * time.Millisecond
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pemCerts, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemCerts) {
+		return nil, fmt.Errorf("No certificates found in %s", file)
+	}
+	return pool, nil
+}
+
 var (
 	version     = flag.Bool("version", false, "Version info")
 	logFilePath = flag.String("logFile", "", "The agent log file, defaults to STDOUT")
@@ -87,22 +310,39 @@ func main() {
 		panic(err)
 	}
 
+	// Loads the drain certificates, which validate leaves alone so they are
+	// only read once.
+	drainConfig, err := config.drainConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	if config.DrainSpoolDirectory != "" && drainConfig.SpoolMaxAge > 0 {
+		removeExpiredSpools(drainConfig, logger)
+	}
+
 	agentListener := agentlistener.NewAgentListener(fmt.Sprintf("0.0.0.0:%d", config.IncomingPort), logger)
 	incomingLogChan := agentListener.Start()
 
-	sinkManager := sinkserver.NewSinkManager(config.MaxRetainedLogMessages, config.SkipCertVerify, config.BlackListIps, logger)
+	sinkManager := sinkserver.NewSinkManager(config.MaxRetainedLogMessages, config.MaxRetainedLogBytes, config.RecentLogBudgetBytes, drainConfig, config.BlackListIps, logger)
 	go sinkManager.Start()
 
+	if config.RecentLogSnapshotFile != "" {
+		restoreRecentLogs(sinkManager, config, logger)
+	}
+
 	unmarshaller := func(data []byte) (*logmessage.Message, error) {
 		return logmessage.ParseEnvelope(data, config.SharedSecret)
 	}
 
 	messageChannelLength := 2048
-	messageRouter := sinkserver.NewMessageRouter(incomingLogChan, unmarshaller, sinkManager, messageChannelLength, logger)
+	redactor, _ := redaction.NewRedactor(config.RedactionRules)
+	messageRouter := sinkserver.NewMessageRouter(incomingLogChan, unmarshaller, sinkManager, redactor, messageChannelLength, logger)
 
 	apiEndpoint := fmt.Sprintf("0.0.0.0:%d", config.OutgoingPort)
 	keepAliveInterval := 30 * time.Second
-	websocketServer := sinkserver.NewWebsocketServer(apiEndpoint, sinkManager, keepAliveInterval, config.WSMessageBufferSize, logger)
+	wsOverflowPolicy, _ := config.overflowPolicy(config.WSMessageOverflowPolicy)
+	websocketServer := sinkserver.NewWebsocketServer(apiEndpoint, sinkManager, keepAliveInterval, config.WSMessageBufferSize, wsOverflowPolicy, logger)
 
 	cfc, err := cfcomponent.NewComponent(
 		logger,
@@ -111,7 +351,7 @@ func main() {
 		&LoggregatorServerHealthMonitor{},
 		config.VarzPort,
 		[]string{config.VarzUser, config.VarzPass},
-		[]instrumentation.Instrumentable{agentListener, sinkManager, messageRouter},
+		[]instrumentation.Instrumentable{agentListener, sinkManager, messageRouter, redactor, messageRouter.DroppedMessages, sinkManager.BufferDroppedMessages},
 	)
 
 	if err != nil {
@@ -134,21 +374,69 @@ func main() {
 	go messageRouter.Start()
 	go websocketServer.Start()
 
-	killChan := make(chan os.Signal)
-	signal.Notify(killChan, os.Kill)
+	if config.DrainStatusPort != 0 {
+		drainStatusEndpoint := fmt.Sprintf("0.0.0.0:%d", config.DrainStatusPort)
+		go sinkserver.NewDrainStatusServer(drainStatusEndpoint, sinkManager, config.VarzUser, config.VarzPass, logger).Start()
+	}
+
+	killChan := make(chan os.Signal, 1)
+	signal.Notify(killChan, os.Interrupt, syscall.SIGTERM)
 
 	for {
 		select {
 		case <-cfcomponent.RegisterGoRoutineDumpSignalChannel():
 			cfcomponent.DumpGoRoutine()
 		case <-killChan:
-			break
+			if config.RecentLogSnapshotFile != "" {
+				saveRecentLogs(sinkManager, config, logger)
+			}
+			return
 		}
 	}
 }
 
+func removeExpiredSpools(drainConfig sinks.DrainConfig, logger *gosteno.Logger) {
+	removed, err := spool.RemoveExpired(drainConfig.SpoolDirectory, drainConfig.SpoolMaxAge)
+	if err != nil {
+		logger.Warnf("Unable to remove expired drain spools from %s. Err: %v", drainConfig.SpoolDirectory, err)
+	}
+	logger.Infof("Removed %d expired drain spools.", removed)
+}
+
+func restoreRecentLogs(sinkManager *sinkserver.SinkManager, config *Config, logger *gosteno.Logger) {
+	maxAge := time.Duration(config.RecentLogSnapshotMaxAgeSeconds) * time.Second
+	restored, expired, err := sinkManager.RestoreRecentLogs(config.RecentLogSnapshotFile, maxAge)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warnf("Unable to restore all recent logs from %s. Err: %v", config.RecentLogSnapshotFile, err)
+	}
+	logger.Infof("Restored %d recent log messages, skipped %d expired ones.", restored, expired)
+}
+
+func saveRecentLogs(sinkManager *sinkserver.SinkManager, config *Config, logger *gosteno.Logger) {
+	saved, err := sinkManager.SaveRecentLogs(config.RecentLogSnapshotFile)
+	if err != nil {
+		logger.Errorf("Unable to save recent logs to %s. Err: %v", config.RecentLogSnapshotFile, err)
+		return
+	}
+	logger.Infof("Saved %d recent log messages.", saved)
+}
+
 func parseConfig(logLevel *bool, configFile, logFilePath *string) (*Config, *gosteno.Logger) {
-	config := &Config{IncomingPort: 3456, OutgoingPort: 8080, WSMessageBufferSize: 100}
+	config := &Config{
+		IncomingPort:                     3456,
+		OutgoingPort:                     8080,
+		WSMessageBufferSize:              100,
+		DrainSpoolMaxBytes:               10 * 1024 * 1024,
+		DrainSpoolMaxAgeSeconds:          3600,
+		DrainCircuitBreakerProbeSeconds:  300,
+		DrainRetryStrategy:               retrystrategy.Exponential,
+		DrainRetryMaxDelaySeconds:        300,
+		DrainRetryIntervalSeconds:        10,
+		DrainDNSTTLSeconds:               60,
+		DrainWriteTimeoutSeconds:         30,
+		OverflowBlockTimeoutMilliseconds: 100,
+		RecentLogSnapshotMaxAgeSeconds:   3600,
+	}
 	err := cfcomponent.ReadConfigInto(config, *configFile)
 	if err != nil {
 		panic(err)
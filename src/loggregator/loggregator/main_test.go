@@ -2,7 +2,10 @@ package main
 
 import (
 	"github.com/stretchr/testify/assert"
+	"loggregator/buffer/truncatingbuffer"
+	"loggregator/sinks/syslogwriter"
 	"testing"
+	"time"
 )
 
 //Test parseConfig
@@ -15,6 +18,27 @@ func TestDefaultConfig(t *testing.T) {
 	assert.Equal(t, config.IncomingPort, uint32(3456))
 	assert.Equal(t, config.OutgoingPort, uint32(8080))
 	assert.Equal(t, config.WSMessageBufferSize, uint(100))
+	assert.Equal(t, config.MaxRetainedLogBytes, 0)
+	assert.Equal(t, config.RecentLogBudgetBytes, 0)
+	assert.Equal(t, config.RecentLogSnapshotFile, "")
+	assert.Equal(t, config.RecentLogSnapshotMaxAgeSeconds, 3600)
+	assert.Equal(t, config.DrainSpoolDirectory, "")
+	assert.Equal(t, config.DrainSpoolMaxBytes, int64(10*1024*1024))
+	assert.Equal(t, config.DrainSpoolMaxAgeSeconds, 3600)
+	assert.Equal(t, config.DrainStatusPort, uint32(0))
+	assert.Equal(t, config.DrainCircuitBreakerMaxFailures, 0)
+	assert.Equal(t, config.DrainCircuitBreakerMaxFailureSeconds, 0)
+	assert.Equal(t, config.DrainCircuitBreakerProbeSeconds, 300)
+	assert.Equal(t, config.DrainRetryStrategy, "exponential")
+	assert.Equal(t, config.DrainRetryMaxDelaySeconds, 300)
+	assert.Equal(t, config.DrainRetryIntervalSeconds, 10)
+	assert.Equal(t, config.DrainMessageRateLimit, float64(0))
+	assert.Equal(t, config.AppDrainByteRateLimit, float64(0))
+	assert.Equal(t, config.DrainDNSTTLSeconds, 60)
+	assert.Equal(t, config.DrainWriteTimeoutSeconds, 30)
+	assert.Equal(t, config.WSMessageOverflowPolicy, "")
+	assert.Equal(t, config.OverflowBlockTimeoutMilliseconds, 100)
+	assert.Nil(t, config.RedactionRules)
 }
 
 func TestParseConfigWorksWithEmptyBlackligtIpProperty(t *testing.T) {
@@ -33,10 +57,38 @@ func TestParseConfigReturnsProperConfigObject(t *testing.T) {
 	assert.Equal(t, config.IncomingPort, uint32(8765))
 	assert.Equal(t, config.OutgoingPort, uint32(4567))
 	assert.Equal(t, config.WSMessageBufferSize, uint(100))
+	assert.Equal(t, config.MaxRetainedLogBytes, 65536)
+	assert.Equal(t, config.RecentLogBudgetBytes, 268435456)
+	assert.Equal(t, config.RecentLogSnapshotFile, "/var/vcap/data/loggregator/recent_logs.snapshot")
+	assert.Equal(t, config.RecentLogSnapshotMaxAgeSeconds, 600)
 	assert.Equal(t, config.BlackListIps[0].Start, "127.0.0.0")
 	assert.Equal(t, config.BlackListIps[0].End, "127.0.0.2")
 	assert.Equal(t, config.BlackListIps[1].Start, "127.0.1.12")
 	assert.Equal(t, config.BlackListIps[1].End, "127.0.1.15")
+	assert.Equal(t, config.DrainSpoolDirectory, "/var/vcap/data/loggregator/spool")
+	assert.Equal(t, config.DrainSpoolMaxBytes, int64(1048576))
+	assert.Equal(t, config.DrainSpoolMaxAgeSeconds, 3600)
+	assert.Equal(t, config.DrainStatusPort, uint32(8889))
+	assert.Equal(t, config.DrainCircuitBreakerMaxFailures, 20)
+	assert.Equal(t, config.DrainCircuitBreakerMaxFailureSeconds, 0)
+	assert.Equal(t, config.DrainCircuitBreakerProbeSeconds, 600)
+	assert.Equal(t, config.DrainRetryStrategy, "decorrelated-jitter")
+	assert.Equal(t, config.DrainRetryMaxDelaySeconds, 120)
+	assert.Equal(t, config.DrainRetryIntervalSeconds, 10)
+	assert.Equal(t, config.DrainMessageRateLimit, float64(100))
+	assert.Equal(t, config.DrainByteRateLimit, float64(0))
+	assert.Equal(t, config.AppDrainMessageRateLimit, float64(0))
+	assert.Equal(t, config.AppDrainByteRateLimit, float64(65536))
+	assert.Equal(t, config.DrainDNSTTLSeconds, 30)
+	assert.Equal(t, config.DrainWriteTimeoutSeconds, 10)
+	assert.Equal(t, config.WSMessageOverflowPolicy, "drop-oldest")
+	assert.Equal(t, config.DrainSyslogOverflowPolicy, "block")
+	assert.Equal(t, config.DrainHttpsOverflowPolicy, "drop-newest")
+	assert.Equal(t, config.OverflowBlockTimeoutMilliseconds, 250)
+	assert.Equal(t, len(config.RedactionRules), 1)
+	assert.Equal(t, config.RedactionRules[0].Name, "password")
+	assert.Equal(t, config.RedactionRules[0].Pattern, "(password=)\\S+")
+	assert.Equal(t, config.RedactionRules[0].Replacement, "${1}[REDACTED]")
 }
 
 func TestParseConfigReturnsProperLogger(t *testing.T) {
@@ -51,3 +103,70 @@ func TestParseConfigReturnsProperLogger(t *testing.T) {
 	_, logger = parseConfig(&logLevel, &configFile, &logFilePath)
 	assert.Equal(t, logger.Level().String(), "debug")
 }
+
+func TestDrainConfigLoadsTLSCertificates(t *testing.T) {
+	logLevel := false
+	configFile := "./test_assets/loggregator.json"
+	logFilePath := "./test_assets/stdout.log"
+	config, _ := parseConfig(&logLevel, &configFile, &logFilePath)
+
+	drainConfig, err := config.drainConfig()
+	assert.NoError(t, err)
+	assert.NotNil(t, drainConfig.ClientCertificate)
+	assert.NotNil(t, drainConfig.RootCAs)
+	assert.Equal(t, len(drainConfig.ClientCertificates["team-a"].Certificate.Certificate), 1)
+	assert.Equal(t, drainConfig.ClientCertificates["team-a"].AppIds, []string{"app-a"})
+	assert.NotNil(t, drainConfig.CABundles["private"].RootCAs)
+	assert.Equal(t, drainConfig.CABundles["private"].AppIds, []string{"app-a", "app-b"})
+
+	config.DrainTLSCABundles["missing"] = CABundleFile{File: "./test_assets/missing.pem"}
+	_, err = config.drainConfig()
+	assert.Error(t, err)
+}
+
+func TestDrainConfigSetsSyslogHeader(t *testing.T) {
+	logLevel := false
+	configFile := "./test_assets/loggregator.json"
+	logFilePath := "./test_assets/stdout.log"
+	config, _ := parseConfig(&logLevel, &configFile, &logFilePath)
+
+	drainConfig, err := config.drainConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, drainConfig.SyslogHeader, syslogwriter.Header{Hostname: "loggregator-z1", Facility: 16, StructuredData: true})
+
+	config.DrainSyslogFacility = "kern"
+	_, err = config.drainConfig()
+	assert.Error(t, err)
+}
+
+func TestDrainConfigSetsOverflowPolicies(t *testing.T) {
+	logLevel := false
+	configFile := "./test_assets/loggregator.json"
+	logFilePath := "./test_assets/stdout.log"
+	config, _ := parseConfig(&logLevel, &configFile, &logFilePath)
+
+	drainConfig, err := config.drainConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, drainConfig.SyslogOverflowPolicy, "block")
+	assert.Equal(t, drainConfig.HttpsOverflowPolicy, "drop-newest")
+	assert.Equal(t, drainConfig.OverflowBlockTimeout, 250*time.Millisecond)
+
+	policy, err := config.overflowPolicy(config.WSMessageOverflowPolicy)
+	assert.NoError(t, err)
+	assert.Equal(t, policy, truncatingbuffer.Policy{Name: truncatingbuffer.DropOldest})
+
+	_, err = config.overflowPolicy("drop-everything")
+	assert.Error(t, err)
+}
+
+func TestValidateRejectsBlockingWebsocketSinks(t *testing.T) {
+	logLevel := false
+	configFile := "./test_assets/loggregator.json"
+	logFilePath := "./test_assets/stdout.log"
+	config, logger := parseConfig(&logLevel, &configFile, &logFilePath)
+
+	config.WSMessageOverflowPolicy = truncatingbuffer.Block
+	err := config.validate(logger)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "WSMessageOverflowPolicy must not be block")
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/cloudfoundry/loggregatorlib/agentlistener"
 	messagetesthelpers "github.com/cloudfoundry/loggregatorlib/logmessage/testhelpers"
 	"github.com/stretchr/testify/assert"
+	"loggregator/buffer/truncatingbuffer"
+	"loggregator/sinks"
 	"loggregator/sinkserver"
 	"net"
 	testhelpers "server_testhelpers"
@@ -18,13 +20,13 @@ func init() {
 	listener := agentlistener.NewAgentListener("localhost:3456", logger)
 	incomingLogChan := listener.Start()
 
-	sinkManager := sinkserver.NewSinkManager(1024, false, nil, logger)
+	sinkManager := sinkserver.NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
 	go sinkManager.Start()
 
-	messageRouter := sinkserver.NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, 2048, logger)
+	messageRouter := sinkserver.NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
 	go messageRouter.Start()
 
-	websocketServer := sinkserver.NewWebsocketServer("localhost:8083", sinkManager, 30*time.Second, 100, logger)
+	websocketServer := sinkserver.NewWebsocketServer("localhost:8083", sinkManager, 30*time.Second, 100, truncatingbuffer.Policy{}, logger)
 	go websocketServer.Start()
 
 	time.Sleep(50 * time.Millisecond)
@@ -0,0 +1,96 @@
+package redaction
+
+import (
+	"code.google.com/p/gogoprotobuf/proto"
+	"fmt"
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"regexp"
+	"sync/atomic"
+)
+
+// Rule replaces every match of Pattern in a log line with Replacement, which
+// may refer to submatches as in regexp.Expand, e.g. "password=$1[REDACTED]".
+type Rule struct {
+	Name        string
+	Pattern     string
+	Replacement string
+}
+
+type compiledRule struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement []byte
+	count       *uint64
+}
+
+type Redactor struct {
+	rules []compiledRule
+}
+
+// NewRedactor compiles the rules. Rules without a name are named after
+// their position.
+func NewRedactor(rules []Rule) (*Redactor, error) {
+	redactor := &Redactor{}
+	for i, rule := range rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid redaction rule %d: %v", i, err)
+		}
+
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule%d", i)
+		}
+		redactor.rules = append(redactor.rules, compiledRule{
+			name:        name,
+			pattern:     pattern,
+			replacement: []byte(rule.Replacement),
+			count:       new(uint64),
+		})
+	}
+	return redactor, nil
+}
+
+// Redact applies all rules to the text of message. It returns message itself
+// if no rule matched, otherwise a copy whose raw bytes are the marshalled
+// redacted log message. A nil Redactor returns message unchanged.
+func (redactor *Redactor) Redact(message *logmessage.Message) (*logmessage.Message, error) {
+	if redactor == nil {
+		return message, nil
+	}
+
+	text := message.GetLogMessage().GetMessage()
+	redacted := false
+	for _, rule := range redactor.rules {
+		matches := rule.pattern.FindAllIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		atomic.AddUint64(rule.count, uint64(len(matches)))
+		text = rule.pattern.ReplaceAll(text, rule.replacement)
+		redacted = true
+	}
+	if !redacted {
+		return message, nil
+	}
+
+	logMessage := *message.GetLogMessage()
+	logMessage.Message = text
+	rawMessage, err := proto.Marshal(&logMessage)
+	if err != nil {
+		return nil, err
+	}
+	return logmessage.NewMessage(&logMessage, rawMessage), nil
+}
+
+func (redactor *Redactor) Emit() instrumentation.Context {
+	var metrics []instrumentation.Metric
+	for _, rule := range redactor.rules {
+		metrics = append(metrics, instrumentation.Metric{Name: "redactionCount:" + rule.name, Value: atomic.LoadUint64(rule.count)})
+	}
+	return instrumentation.Context{
+		Name:    "redaction",
+		Metrics: metrics,
+	}
+}
@@ -0,0 +1,146 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker gives up on a target after too many consecutive failures,
+// or after it has been failing for too long, and from then on only allows
+// an attempt (a probe) every probe interval until one succeeds.
+type CircuitBreaker struct {
+	maxFailures        int
+	maxFailureDuration time.Duration
+	probeInterval      time.Duration
+
+	sync.Mutex   // guards the fields below
+	state        State
+	failures     int
+	failingSince time.Time
+	openCount    uint64
+}
+
+// New creates a closed CircuitBreaker. A zero maxFailures or
+// maxFailureDuration disables the respective limit.
+func New(maxFailures int, maxFailureDuration time.Duration, probeInterval time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		maxFailures:        maxFailures,
+		maxFailureDuration: maxFailureDuration,
+		probeInterval:      probeInterval,
+	}
+}
+
+// Failure records a failed attempt and reports whether it opened the circuit.
+func (cb *CircuitBreaker) Failure() bool {
+	cb.Lock()
+	defer cb.Unlock()
+
+	if cb.failures == 0 {
+		cb.failingSince = time.Now()
+	}
+	cb.failures++
+
+	switch cb.state {
+	case HalfOpen:
+		cb.state = Open
+	case Closed:
+		if cb.tripped() {
+			cb.state = Open
+			cb.openCount++
+			return true
+		}
+	}
+	return false
+}
+
+func (cb *CircuitBreaker) tripped() bool {
+	if cb.maxFailures > 0 && cb.failures >= cb.maxFailures {
+		return true
+	}
+	return cb.maxFailureDuration > 0 && time.Since(cb.failingSince) >= cb.maxFailureDuration
+}
+
+// Success records a successful attempt and reports whether it closed an
+// open circuit.
+func (cb *CircuitBreaker) Success() bool {
+	cb.Lock()
+	defer cb.Unlock()
+
+	wasOpen := cb.state != Closed
+	cb.state = Closed
+	cb.failures = 0
+	return wasOpen
+}
+
+// Probe marks the circuit as half-open while an attempt is made on an open
+// circuit.
+func (cb *CircuitBreaker) Probe() {
+	cb.Lock()
+	defer cb.Unlock()
+
+	if cb.state == Open {
+		cb.state = HalfOpen
+	}
+}
+
+func (cb *CircuitBreaker) State() State {
+	cb.Lock()
+	defer cb.Unlock()
+
+	return cb.state
+}
+
+func (cb *CircuitBreaker) IsOpen() bool {
+	return cb.State() != Closed
+}
+
+// Failures returns the number of consecutive failures so far.
+func (cb *CircuitBreaker) Failures() int {
+	cb.Lock()
+	defer cb.Unlock()
+
+	return cb.failures
+}
+
+// FailingFor returns how long the target has been failing.
+func (cb *CircuitBreaker) FailingFor() time.Duration {
+	cb.Lock()
+	defer cb.Unlock()
+
+	if cb.failures == 0 {
+		return 0
+	}
+	return time.Since(cb.failingSince)
+}
+
+// OpenCount returns how many times the circuit was opened.
+func (cb *CircuitBreaker) OpenCount() uint64 {
+	cb.Lock()
+	defer cb.Unlock()
+
+	return cb.openCount
+}
+
+func (cb *CircuitBreaker) ProbeInterval() time.Duration {
+	return cb.probeInterval
+}
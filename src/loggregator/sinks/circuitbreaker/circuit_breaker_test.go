@@ -0,0 +1,61 @@
+package circuitbreaker_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"loggregator/sinks/circuitbreaker"
+	"time"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	It("opens after the maximum number of failures", func() {
+		cb := circuitbreaker.New(3, 0, time.Minute)
+
+		Expect(cb.Failure()).To(BeFalse())
+		Expect(cb.Failure()).To(BeFalse())
+		Expect(cb.State()).To(Equal(circuitbreaker.Closed))
+
+		Expect(cb.Failure()).To(BeTrue())
+		Expect(cb.State()).To(Equal(circuitbreaker.Open))
+		Expect(cb.OpenCount()).To(Equal(uint64(1)))
+	})
+
+	It("opens once the target has been failing for too long", func() {
+		cb := circuitbreaker.New(0, 10*time.Millisecond, time.Minute)
+
+		Expect(cb.Failure()).To(BeFalse())
+		time.Sleep(20 * time.Millisecond)
+		Expect(cb.Failure()).To(BeTrue())
+		Expect(cb.IsOpen()).To(BeTrue())
+	})
+
+	It("reports opening only once while probes keep failing", func() {
+		cb := circuitbreaker.New(1, 0, time.Minute)
+		Expect(cb.Failure()).To(BeTrue())
+
+		cb.Probe()
+		Expect(cb.State()).To(Equal(circuitbreaker.HalfOpen))
+		Expect(cb.Failure()).To(BeFalse())
+		Expect(cb.State()).To(Equal(circuitbreaker.Open))
+		Expect(cb.Failures()).To(Equal(2))
+	})
+
+	It("closes and resets on success", func() {
+		cb := circuitbreaker.New(1, 0, time.Minute)
+		Expect(cb.Success()).To(BeFalse())
+
+		cb.Failure()
+		cb.Probe()
+		Expect(cb.Success()).To(BeTrue())
+		Expect(cb.State()).To(Equal(circuitbreaker.Closed))
+		Expect(cb.Failures()).To(Equal(0))
+		Expect(cb.FailingFor()).To(Equal(time.Duration(0)))
+	})
+
+	It("never opens without limits", func() {
+		cb := circuitbreaker.New(0, 0, time.Minute)
+		for i := 0; i < 100; i++ {
+			Expect(cb.Failure()).To(BeFalse())
+		}
+	})
+})
@@ -0,0 +1,137 @@
+package sinks
+
+import (
+	"code.google.com/p/gogoprotobuf/proto"
+	"fmt"
+	"github.com/cloudfoundry/gosteno"
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"multiline"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// newMultilineConfig returns the multi-line coalescing settings of the
+// drain URL, or nil if the drain does not coalesce messages. Coalescing is
+// turned on with multiline=true and tuned with multiline_pattern,
+// multiline_timeout and multiline_max_bytes.
+func newMultilineConfig(parsedUrl *url.URL) (*multiline.Config, error) {
+	query := parsedUrl.Query()
+	enabled := query.Get("multiline") == "true"
+
+	config := &multiline.Config{ContinuationPattern: query.Get("multiline_pattern")}
+	if value := query.Get("multiline_timeout"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid multiline_timeout: %s", value)
+		}
+		config.FlushTimeoutMilliseconds = int(timeout / time.Millisecond)
+		enabled = true
+	}
+	if value := query.Get("multiline_max_bytes"); value != "" {
+		maxBytes, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid multiline_max_bytes: %s", value)
+		}
+		config.MaxBytes = maxBytes
+		enabled = true
+	}
+	if config.ContinuationPattern != "" {
+		enabled = true
+	}
+
+	if !enabled {
+		return nil, nil
+	}
+	return config, config.Validate()
+}
+
+type stream struct {
+	sourceName  string
+	sourceId    string
+	messageType logmessage.LogMessage_MessageType
+}
+
+type coalescingStream struct {
+	coalescer *multiline.Coalescer
+	first     *logmessage.LogMessage
+}
+
+// coalesce coalesces the lines of the messages from in into multi-line
+// messages, separately for every source and message type. The messages it
+// builds carry the metadata of their first line. The returned channel is
+// closed once in is closed and all pending messages are flushed.
+func coalesce(in <-chan *logmessage.Message, config multiline.Config, logger *gosteno.Logger) <-chan *logmessage.Message {
+	out := make(chan *logmessage.Message)
+	streams := make(map[stream]*coalescingStream)
+	newCoalescer := func() *multiline.Coalescer {
+		coalescer, _ := multiline.NewCoalescer(config)
+		return coalescer
+	}
+
+	send := func(first *logmessage.LogMessage, lines []byte) {
+		logMessage := *first
+		logMessage.Message = lines
+		rawMessage, err := proto.Marshal(&logMessage)
+		if err != nil {
+			logger.Warnf("Dropping coalesced message that could not be marshalled. Err: %v", err)
+			return
+		}
+		out <- logmessage.NewMessage(&logMessage, rawMessage)
+	}
+
+	add := func(message *logmessage.Message) {
+		logMessage := message.GetLogMessage()
+		key := stream{logMessage.GetSourceName(), logMessage.GetSourceId(), logMessage.GetMessageType()}
+		s, ok := streams[key]
+		if !ok {
+			s = &coalescingStream{coalescer: newCoalescer()}
+			streams[key] = s
+		}
+
+		for _, line := range multiline.Lines(logMessage.GetMessage()) {
+			if !s.coalescer.Pending() {
+				s.first = logMessage
+			}
+			if lines := s.coalescer.Add(line); lines != nil {
+				send(s.first, lines)
+				s.first = logMessage
+			}
+		}
+	}
+
+	flushExpired := func(now time.Time) {
+		for key, s := range streams {
+			if s.coalescer.Expired(now) {
+				send(s.first, s.coalescer.Flush())
+				delete(streams, key)
+			}
+		}
+	}
+
+	go func() {
+		defer close(out)
+
+		ticker := time.NewTicker(newCoalescer().FlushTimeout() / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case message, ok := <-in:
+				if !ok {
+					for _, s := range streams {
+						if s.coalescer.Pending() {
+							send(s.first, s.coalescer.Flush())
+						}
+					}
+					return
+				}
+				add(message)
+			case now := <-ticker.C:
+				flushExpired(now)
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,284 @@
+package sinks
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/cloudfoundry/gosteno"
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"loggregator/buffer/truncatingbuffer"
+	"loggregator/dropcounter"
+	"loggregator/iprange"
+	"loggregator/sinks/ratelimiter"
+	"loggregator/sinks/retrystrategy"
+	"loggregator/sinks/syslogwriter"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Drain is a Sink that forwards an app's logs to a third party endpoint
+// bound to the app through a drain URL.
+type Drain interface {
+	Sink
+	Disconnect()
+	DrainType() string
+	IsConnected() bool
+	Status() DrainStatus
+}
+
+// A SpoolingDrain keeps the messages it could not send on disk. Its spool
+// outlives it, so the messages are sent by the next drain for the same URL,
+// unless DiscardSpool was called before it stopped.
+type SpoolingDrain interface {
+	Drain
+	DiscardSpool()
+}
+
+// TLSClientCertificate is a client certificate the drains of AppIds may
+// present.
+type TLSClientCertificate struct {
+	Certificate tls.Certificate
+	AppIds      []string
+}
+
+// TLSCABundle is a CA bundle the drains of AppIds may be verified against.
+type TLSCABundle struct {
+	RootCAs *x509.CertPool
+	AppIds  []string
+}
+
+// DrainConfig holds the server wide settings that apply to every drain.
+type DrainConfig struct {
+	SkipCertVerify bool
+
+	// Syslog drains spool messages to disk while they are unreachable if
+	// SpoolDirectory is set.
+	SpoolDirectory string
+	SpoolMaxSize   int64
+	SpoolMaxAge    time.Duration
+
+	// Syslog drains that failed CircuitBreakerMaxFailures times in a row, or
+	// kept failing for CircuitBreakerMaxFailureDuration, are only retried
+	// every CircuitBreakerProbeInterval. Zero disables the respective limit.
+	CircuitBreakerMaxFailures        int
+	CircuitBreakerMaxFailureDuration time.Duration
+	CircuitBreakerProbeInterval      time.Duration
+
+	// RetryStrategy names the retrystrategy drains back off with. Drain URLs
+	// may override it and its settings with the retry, retry_max_delay and
+	// retry_interval query parameters, but not wait less than configured.
+	RetryStrategy string
+	RetryMaxDelay time.Duration
+	RetryInterval time.Duration
+
+	// Syslog drains send at most MessageRateLimit messages and
+	// ByteRateLimit bytes per second. Their URL may lower the limits with
+	// the rate_limit and byte_rate_limit query parameters. Zero means
+	// unlimited. All drains of an app together are limited to
+	// AppMessageRateLimit and AppByteRateLimit through AppRateLimiter, which
+	// is set per app when the drain is created.
+	MessageRateLimit    float64
+	ByteRateLimit       float64
+	AppMessageRateLimit float64
+	AppByteRateLimit    float64
+	AppRateLimiter      *ratelimiter.Limiter
+
+	// Syslog drains resolve their host again every DNSTTL and never
+	// connect to addresses in BlacklistIPs.
+	DNSTTL       time.Duration
+	BlacklistIPs []iprange.IPRange
+
+	// Syslog drains disconnect and reconnect when a write takes longer than
+	// WriteTimeout. Zero does not limit writes.
+	WriteTimeout time.Duration
+
+	// Syslog drains over TLS present ClientCertificate, if set, and are
+	// verified against RootCAs, or the system roots if nil. Drain URLs may
+	// pick other ones by name from ClientCertificates and CABundles with
+	// the tls_client_cert and tls_ca query parameters, if their app is
+	// allowed to.
+	ClientCertificate  *tls.Certificate
+	RootCAs            *x509.CertPool
+	ClientCertificates map[string]TLSClientCertificate
+	CABundles          map[string]TLSCABundle
+
+	// SyslogHeader holds the RFC5424 header fields syslog drains send
+	// unless their URL overrides them.
+	SyslogHeader syslogwriter.Header
+
+	// Syslog and HTTPS drains handle overflows of their message buffer
+	// with the truncatingbuffer policy named SyslogOverflowPolicy and
+	// HttpsOverflowPolicy, blocking for up to OverflowBlockTimeout with the
+	// block policy. Drain URLs may override them with the overflow and
+	// overflow_timeout query parameters, except that they may not pick the
+	// block policy or a longer timeout.
+	SyslogOverflowPolicy string
+	HttpsOverflowPolicy  string
+	OverflowBlockTimeout time.Duration
+
+	// Drains count the messages their buffer drops per app in
+	// AppDroppedMessages if set.
+	AppDroppedMessages *dropcounter.Counter
+}
+
+// DrainFactory builds a Drain for an app from its raw and parsed drain URL.
+type DrainFactory func(appId string, drainUrl string, parsedUrl *url.URL, config DrainConfig, logger *gosteno.Logger, errorChannel chan<- *logmessage.Message) (Drain, error)
+
+type DrainRegistry struct {
+	factories      map[string]DrainFactory
+	defaultFactory DrainFactory
+	sync.RWMutex
+}
+
+// NewDrainRegistry creates a registry that falls back to defaultFactory for
+// URL schemes nobody registered.
+func NewDrainRegistry(defaultFactory DrainFactory) *DrainRegistry {
+	return &DrainRegistry{
+		factories:      make(map[string]DrainFactory),
+		defaultFactory: defaultFactory,
+	}
+}
+
+// NewDefaultDrainRegistry knows about all the drain types shipped with
+// loggregator. Any scheme it does not know is treated as plain syslog.
+func NewDefaultDrainRegistry() *DrainRegistry {
+	registry := NewDrainRegistry(newSyslogDrain)
+	registry.Register("syslog", newSyslogDrain)
+	registry.Register("syslog-tls", newSyslogDrain)
+	registry.Register("syslog-udp", newSyslogDrain)
+	registry.Register("json+tcp", newSyslogDrain)
+	registry.Register("json+tls", newSyslogDrain)
+	registry.Register("gelf", newSyslogDrain)
+	registry.Register("gelf+udp", newSyslogDrain)
+	registry.Register("gelf+tcp", newSyslogDrain)
+	registry.Register("relp", newSyslogDrain)
+	registry.Register("https", newHttpsDrain)
+	return registry
+}
+
+func (registry *DrainRegistry) Register(scheme string, factory DrainFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.factories[scheme] = factory
+}
+
+func (registry *DrainRegistry) NewDrain(appId string, drainUrl string, parsedUrl *url.URL, config DrainConfig, logger *gosteno.Logger, errorChannel chan<- *logmessage.Message) (Drain, error) {
+	registry.RLock()
+	factory, ok := registry.factories[parsedUrl.Scheme]
+	registry.RUnlock()
+
+	if !ok {
+		factory = registry.defaultFactory
+	}
+	return factory(appId, drainUrl, parsedUrl, config, logger, errorChannel)
+}
+
+// newRetryStrategy creates the retry strategy configured for the drain,
+// taking overrides from the query of its URL into account. An overridden
+// strategy never retries sooner than the configured one would.
+func newRetryStrategy(parsedUrl *url.URL, config DrainConfig) (retrystrategy.RetryStrategy, error) {
+	configured, err := retrystrategy.New(config.RetryStrategy, config.RetryMaxDelay, config.RetryInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	query := parsedUrl.Query()
+	if query.Get("retry") == "" && query.Get("retry_max_delay") == "" && query.Get("retry_interval") == "" {
+		return configured, nil
+	}
+
+	name := config.RetryStrategy
+	if value := query.Get("retry"); value != "" {
+		name = value
+	}
+
+	maxDelay := config.RetryMaxDelay
+	if value := query.Get("retry_max_delay"); value != "" {
+		maxDelay, err = time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid retry_max_delay: %v", err)
+		}
+	}
+
+	interval := config.RetryInterval
+	if value := query.Get("retry_interval"); value != "" {
+		interval, err = time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid retry_interval: %v", err)
+		}
+	}
+
+	overridden, err := retrystrategy.New(name, maxDelay, interval)
+	if err != nil {
+		return nil, err
+	}
+	return retrystrategy.NewAtLeastRetryStrategy(overridden, configured), nil
+}
+
+// newOverflowPolicy creates the overflow policy of the drain's message
+// buffer, taking overrides from the query of its URL into account. A
+// blocking buffer holds up the messages of all apps, so drain URLs may
+// neither pick the block policy nor block for longer than configured.
+func newOverflowPolicy(parsedUrl *url.URL, name string, config DrainConfig) (truncatingbuffer.Policy, error) {
+	query := parsedUrl.Query()
+
+	if value := query.Get("overflow"); value != "" {
+		if value == truncatingbuffer.Block && name != truncatingbuffer.Block {
+			return truncatingbuffer.Policy{}, fmt.Errorf("Drain URLs may not pick the %s overflow policy", value)
+		}
+		name = value
+	}
+
+	blockTimeout := config.OverflowBlockTimeout
+	if value := query.Get("overflow_timeout"); value != "" {
+		var err error
+		blockTimeout, err = time.ParseDuration(value)
+		if err != nil {
+			return truncatingbuffer.Policy{}, fmt.Errorf("Invalid overflow_timeout: %v", err)
+		}
+		if blockTimeout > config.OverflowBlockTimeout {
+			blockTimeout = config.OverflowBlockTimeout
+		}
+	}
+
+	return truncatingbuffer.NewPolicy(name, blockTimeout)
+}
+
+// newRateLimiter creates the rate limiter for the drain. The query of its
+// URL may only tighten the configured limits.
+func newRateLimiter(parsedUrl *url.URL, config DrainConfig) (*ratelimiter.Limiter, error) {
+	query := parsedUrl.Query()
+
+	messageRateLimit, err := tighterRateLimit(config.MessageRateLimit, "rate_limit", query.Get("rate_limit"))
+	if err != nil {
+		return nil, err
+	}
+
+	byteRateLimit, err := tighterRateLimit(config.ByteRateLimit, "byte_rate_limit", query.Get("byte_rate_limit"))
+	if err != nil {
+		return nil, err
+	}
+
+	return ratelimiter.New(messageRateLimit, byteRateLimit, config.AppRateLimiter), nil
+}
+
+// tighterRateLimit returns the lower of the configured limit and the value
+// of the named query parameter. Only the configured limit may be 0 for
+// unlimited, so drain URLs cannot lift it.
+func tighterRateLimit(configured float64, name string, value string) (float64, error) {
+	if value == "" {
+		return configured, nil
+	}
+
+	limit, err := strconv.ParseFloat(value, 64)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("Invalid %s: %s", name, value)
+	}
+	if configured > 0 && configured < limit {
+		return configured, nil
+	}
+	return limit, nil
+}
@@ -0,0 +1,30 @@
+package sinks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"loggregator/sinks/retrystrategy"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRetryOverridesDoNotRetrySoonerThanConfigured(t *testing.T) {
+	parsedUrl, _ := url.Parse("syslog://localhost:24632?retry=fixed&retry_interval=100ms")
+	strategy, err := newRetryStrategy(parsedUrl, DrainConfig{RetryStrategy: retrystrategy.Exponential})
+	assert.NoError(t, err)
+	for counter := 10; counter < 15; counter++ {
+		assert.True(t, strategy(counter) >= 256*time.Millisecond)
+	}
+
+	parsedUrl, _ = url.Parse("syslog://localhost:24632?retry=capped-exponential&retry_max_delay=1s")
+	strategy, err = newRetryStrategy(parsedUrl, DrainConfig{RetryStrategy: retrystrategy.FixedInterval, RetryInterval: 10 * time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, strategy(1))
+}
+
+func TestRetryOverridesMayRetryLater(t *testing.T) {
+	parsedUrl, _ := url.Parse("syslog://localhost:24632?retry_interval=1m")
+	strategy, err := newRetryStrategy(parsedUrl, DrainConfig{RetryStrategy: retrystrategy.FixedInterval, RetryInterval: 10 * time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, strategy(1))
+}
@@ -0,0 +1,114 @@
+package sinks
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DrainStatus is a point in time view of the health of a drain.
+type DrainStatus struct {
+	AppId                 string     `json:"app_id"`
+	DrainUrl              string     `json:"drain_url"`
+	DrainType             string     `json:"drain_type"`
+	Connected             bool       `json:"connected"`
+	ConnectedSince        *time.Time `json:"connected_since,omitempty"`
+	LastError             string     `json:"last_error,omitempty"`
+	LastErrorAt           *time.Time `json:"last_error_at,omitempty"`
+	CurrentBackoffSeconds float64    `json:"current_backoff_seconds"`
+	ConsecutiveFailures   int        `json:"consecutive_failures"`
+	SentMessages          uint64     `json:"sent_messages"`
+	DroppedMessages       uint64     `json:"dropped_messages"`
+	CircuitState          string     `json:"circuit_state,omitempty"`
+}
+
+// CircuitOpen reports whether the drain gave up and is only being probed.
+func (status DrainStatus) CircuitOpen() bool {
+	return status.CircuitState != "" && status.CircuitState != "closed"
+}
+
+// BackingOff reports whether the drain is waiting before its next attempt.
+func (status DrainStatus) BackingOff() bool {
+	return status.CurrentBackoffSeconds > 0
+}
+
+// drainHealth keeps track of the connection state of a drain across
+// successful and failed deliveries.
+type drainHealth struct {
+	connectedSince      time.Time
+	lastError           string
+	lastErrorAt         time.Time
+	currentBackoff      time.Duration
+	consecutiveFailures int
+	sync.Mutex
+}
+
+func (h *drainHealth) succeeded() {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.connectedSince.IsZero() {
+		h.connectedSince = time.Now()
+	}
+	h.currentBackoff = 0
+	h.consecutiveFailures = 0
+}
+
+func (h *drainHealth) failed(err error, backoff time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.connectedSince = time.Time{}
+	h.lastError = err.Error()
+	h.lastErrorAt = time.Now()
+	h.currentBackoff = backoff
+	h.consecutiveFailures++
+}
+
+func (h *drainHealth) status(drain Drain, sent, dropped uint64) DrainStatus {
+	h.Lock()
+	defer h.Unlock()
+
+	status := DrainStatus{
+		AppId:                 drain.AppId(),
+		DrainUrl:              redactDrainUrl(drain.Identifier()),
+		DrainType:             drain.DrainType(),
+		Connected:             drain.IsConnected(),
+		LastError:             h.lastError,
+		CurrentBackoffSeconds: h.currentBackoff.Seconds(),
+		ConsecutiveFailures:   h.consecutiveFailures,
+		SentMessages:          sent,
+		DroppedMessages:       dropped,
+	}
+	if status.Connected && !h.connectedSince.IsZero() {
+		connectedSince := h.connectedSince
+		status.ConnectedSince = &connectedSince
+	}
+	if !h.lastErrorAt.IsZero() {
+		lastErrorAt := h.lastErrorAt
+		status.LastErrorAt = &lastErrorAt
+	}
+	return status
+}
+
+// redactDrainUrl hides the password and the query parameter values of
+// drain URLs, either of which may carry credentials.
+func redactDrainUrl(drainUrl string) string {
+	parsedUrl, err := url.Parse(drainUrl)
+	if err != nil {
+		return drainUrl
+	}
+	if parsedUrl.User != nil {
+		if _, hasPassword := parsedUrl.User.Password(); hasPassword {
+			parsedUrl.User = url.UserPassword(parsedUrl.User.Username(), "REDACTED")
+		}
+	}
+	if parsedUrl.RawQuery != "" {
+		query := parsedUrl.Query()
+		for key := range query {
+			query[key] = []string{"REDACTED"}
+		}
+		parsedUrl.RawQuery = query.Encode()
+	}
+	return parsedUrl.String()
+}
@@ -0,0 +1,259 @@
+package sinks_test
+
+import (
+	"crypto/x509"
+	"errors"
+	"github.com/cloudfoundry/gosteno"
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"github.com/cloudfoundry/loggregatorlib/loggertesthelper"
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"loggregator/sinks"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var _ = Describe("DrainRegistry", func() {
+	var registry *sinks.DrainRegistry
+	var errorChannel chan *logmessage.Message
+
+	newDrain := func(drainUrl string) (sinks.Drain, error) {
+		parsedUrl, err := url.Parse(drainUrl)
+		Expect(err).ToNot(HaveOccurred())
+		return registry.NewDrain("appId", drainUrl, parsedUrl, sinks.DrainConfig{}, loggertesthelper.Logger(), errorChannel)
+	}
+
+	BeforeEach(func() {
+		registry = sinks.NewDefaultDrainRegistry()
+		errorChannel = make(chan *logmessage.Message, 10)
+	})
+
+	It("should build syslog drains for the syslog schemes", func() {
+		for _, drainUrl := range []string{"syslog://localhost:24632", "syslog-tls://localhost:24632", "syslog-udp://localhost:24632", "relp://localhost:24632"} {
+			drain, err := newDrain(drainUrl)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drain.DrainType()).To(Equal("syslog"))
+			Expect(drain.Identifier()).To(Equal(drainUrl))
+			Expect(drain.AppId()).To(Equal("appId"))
+		}
+	})
+
+	It("should build syslog drains writing JSON for the JSON schemes and format", func() {
+		for _, drainUrl := range []string{"json+tcp://localhost:24632", "json+tls://localhost:24632", "syslog://localhost:24632?format=json", "syslog-udp://localhost:24632?format=json"} {
+			drain, err := newDrain(drainUrl)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drain.DrainType()).To(Equal("syslog"))
+		}
+	})
+
+	It("should build syslog drains writing GELF for the GELF schemes and format", func() {
+		for _, drainUrl := range []string{"gelf://localhost:12201", "gelf+udp://localhost:12201", "gelf+tcp://localhost:12201", "syslog-udp://localhost:12201?format=gelf"} {
+			drain, err := newDrain(drainUrl)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drain.DrainType()).To(Equal("syslog"))
+		}
+	})
+
+	It("should accept RFC3164 and non-transparent framing", func() {
+		for _, drainUrl := range []string{"syslog://localhost:24632?format=rfc3164", "syslog-tls://localhost:24632?framing=non-transparent", "syslog://localhost:24632?format=rfc3164&framing=octet-counting"} {
+			_, err := newDrain(drainUrl)
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	It("should reject unknown framings", func() {
+		_, err := newDrain("syslog://localhost:24632?framing=stuffing")
+		Expect(err).To(MatchError("Unknown drain framing: stuffing"))
+	})
+
+	It("should reject unknown drain formats", func() {
+		_, err := newDrain("syslog://localhost:24632?format=xml")
+		Expect(err).To(MatchError("Unknown drain format: xml"))
+	})
+
+	Context("with TLS settings", func() {
+		var config sinks.DrainConfig
+
+		newTLSDrain := func(drainUrl string) (sinks.Drain, error) {
+			parsedUrl, err := url.Parse(drainUrl)
+			Expect(err).ToNot(HaveOccurred())
+			return registry.NewDrain("appId", drainUrl, parsedUrl, config, loggertesthelper.Logger(), errorChannel)
+		}
+
+		BeforeEach(func() {
+			config = sinks.DrainConfig{
+				ClientCertificates: map[string]sinks.TLSClientCertificate{
+					"team-a": sinks.TLSClientCertificate{AppIds: []string{"appId"}},
+					"team-b": sinks.TLSClientCertificate{AppIds: []string{"otherAppId"}},
+				},
+				CABundles: map[string]sinks.TLSCABundle{
+					"private": sinks.TLSCABundle{RootCAs: x509.NewCertPool(), AppIds: []string{"appId"}},
+					"other":   sinks.TLSCABundle{RootCAs: x509.NewCertPool()},
+				},
+			}
+		})
+
+		It("should accept known client certificates, CA bundles, versions, server names and fingerprints", func() {
+			_, err := newTLSDrain("syslog-tls://localhost:24632?tls_client_cert=team-a&tls_ca=private&tls_min_version=1.2&tls_server_name=logs.example.com&tls_fingerprint=" + strings.Repeat("00", 32))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should reject unknown client certificates and CA bundles", func() {
+			_, err := newTLSDrain("syslog-tls://localhost:24632?tls_client_cert=team-c")
+			Expect(err).To(MatchError("Unknown tls_client_cert: team-c"))
+
+			_, err = newTLSDrain("syslog-tls://localhost:24632?tls_ca=public")
+			Expect(err).To(MatchError("Unknown tls_ca: public"))
+		})
+
+		It("should reject client certificates and CA bundles the app is not allowed to use", func() {
+			_, err := newTLSDrain("syslog-tls://localhost:24632?tls_client_cert=team-b")
+			Expect(err).To(MatchError("tls_client_cert team-b is not allowed for app appId"))
+
+			_, err = newTLSDrain("syslog-tls://localhost:24632?tls_ca=other")
+			Expect(err).To(MatchError("tls_ca other is not allowed for app appId"))
+		})
+
+		It("should reject invalid versions and fingerprints", func() {
+			_, err := newTLSDrain("syslog-tls://localhost:24632?tls_min_version=2.0")
+			Expect(err).To(MatchError("Invalid tls_min_version: 2.0"))
+
+			_, err = newTLSDrain("syslog-tls://localhost:24632?tls_fingerprint=abc")
+			Expect(err).To(MatchError("Invalid SHA-256 fingerprint: abc"))
+		})
+	})
+
+	It("should accept RFC5424 header settings", func() {
+		_, err := newDrain("syslog://localhost:24632?hostname=myhost&appname={app_id}-{source_name}&facility=local3&structured_data=true")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should reject invalid RFC5424 header settings", func() {
+		_, err := newDrain("syslog://localhost:24632?facility=kern")
+		Expect(err).To(MatchError("Invalid syslog facility: kern"))
+
+		_, err = newDrain("syslog://localhost:24632?structured_data=maybe")
+		Expect(err).To(MatchError("Invalid structured_data: maybe"))
+	})
+
+	It("should build https drains for the https scheme", func() {
+		drain, err := newDrain("https://localhost:24632/logs")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(drain.DrainType()).To(Equal("https"))
+	})
+
+	It("should fall back to syslog for unknown schemes", func() {
+		drain, err := newDrain("unknown://localhost:24632")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(drain.DrainType()).To(Equal("syslog"))
+	})
+
+	It("should let the drain URL override the retry strategy", func() {
+		for _, drainUrl := range []string{"syslog://localhost:24632?retry=fixed&retry_interval=10s", "https://localhost:24632/logs?retry=decorrelated-jitter&retry_max_delay=1m"} {
+			_, err := newDrain(drainUrl)
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	It("should reject drain URLs with invalid retry settings", func() {
+		_, err := newDrain("syslog://localhost:24632?retry=linear")
+		Expect(err).To(MatchError("Unknown retry strategy: linear"))
+
+		_, err = newDrain("syslog://localhost:24632?retry=fixed&retry_interval=soon")
+		Expect(err).To(MatchError(MatchRegexp("Invalid retry_interval")))
+
+		_, err = newDrain("https://localhost:24632/logs?retry=capped-exponential")
+		Expect(err).To(MatchError("Retry strategy capped-exponential needs a positive maximum delay"))
+	})
+
+	It("should let the drain URL pick the overflow policy", func() {
+		drain, err := newDrain("syslog://localhost:24632?overflow=drop-oldest")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(drain.Emit().Metrics).To(ContainElement(instrumentation.Metric{Name: "bufferDroppedMessageCount.drop-oldest:appId", Value: uint64(0)}))
+	})
+
+	It("should not let the drain URL pick the block overflow policy", func() {
+		_, err := newDrain("syslog://localhost:24632?overflow=block&overflow_timeout=1s")
+		Expect(err).To(MatchError("Drain URLs may not pick the block overflow policy"))
+	})
+
+	Context("with the block overflow policy", func() {
+		var config sinks.DrainConfig
+
+		newBlockingDrain := func(drainUrl string) (sinks.Drain, error) {
+			parsedUrl, err := url.Parse(drainUrl)
+			Expect(err).ToNot(HaveOccurred())
+			return registry.NewDrain("appId", drainUrl, parsedUrl, config, loggertesthelper.Logger(), errorChannel)
+		}
+
+		BeforeEach(func() {
+			config = sinks.DrainConfig{SyslogOverflowPolicy: "block", HttpsOverflowPolicy: "block", OverflowBlockTimeout: time.Second}
+		})
+
+		It("should let the drain URL shorten the timeout", func() {
+			drain, err := newBlockingDrain("https://localhost:24632/logs?overflow=block&overflow_timeout=1ms")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drain.Emit().Metrics).To(ContainElement(instrumentation.Metric{Name: "bufferDroppedMessageCount.block:appId", Value: uint64(0)}))
+		})
+
+		It("should not let the drain URL block for longer than configured", func() {
+			config.OverflowBlockTimeout = 0
+			_, err := newBlockingDrain("syslog://localhost:24632?overflow_timeout=1h")
+			Expect(err).To(MatchError("Overflow policy block needs a positive timeout"))
+		})
+
+		It("should let the drain URL pick a policy that does not block", func() {
+			drain, err := newBlockingDrain("syslog://localhost:24632?overflow=drop-newest")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drain.Emit().Metrics).To(ContainElement(instrumentation.Metric{Name: "bufferDroppedMessageCount.drop-newest:appId", Value: uint64(0)}))
+		})
+	})
+
+	It("should reject drain URLs with invalid overflow settings", func() {
+		_, err := newDrain("syslog://localhost:24632?overflow=drop-everything")
+		Expect(err).To(MatchError("Unknown overflow policy: drop-everything"))
+
+		_, err = newDrain("https://localhost:24632/logs?overflow_timeout=soon")
+		Expect(err).To(MatchError(MatchRegexp("Invalid overflow_timeout")))
+	})
+
+	It("should reject drain URLs with invalid filters", func() {
+		_, err := newDrain("syslog://localhost:24632?types=debug")
+		Expect(err).To(MatchError("Invalid message type in types filter: debug"))
+	})
+
+	It("should reject drain URLs with invalid rate limits", func() {
+		_, err := newDrain("syslog://localhost:24632?rate_limit=fast")
+		Expect(err).To(MatchError("Invalid rate_limit: fast"))
+
+		_, err = newDrain("syslog://localhost:24632?byte_rate_limit=-1")
+		Expect(err).To(MatchError("Invalid byte_rate_limit: -1"))
+
+		_, err = newDrain("syslog://localhost:24632?rate_limit=0")
+		Expect(err).To(MatchError("Invalid rate_limit: 0"))
+	})
+
+	It("should reject drain URLs with invalid multi-line settings", func() {
+		_, err := newDrain("syslog://localhost:24632?multiline_timeout=soon")
+		Expect(err).To(MatchError("Invalid multiline_timeout: soon"))
+
+		_, err = newDrain("syslog://localhost:24632?multiline_pattern=(")
+		Expect(err).To(MatchError(MatchRegexp("Invalid continuation pattern")))
+	})
+
+	It("should reject syslog drain URLs without a port", func() {
+		_, err := newDrain("syslog://localhost")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should use factories registered for new schemes", func() {
+		registry.Register("custom", func(appId string, drainUrl string, parsedUrl *url.URL, config sinks.DrainConfig, logger *gosteno.Logger, errorChannel chan<- *logmessage.Message) (sinks.Drain, error) {
+			return nil, errors.New("custom factory called")
+		})
+
+		_, err := newDrain("custom://localhost:24632")
+		Expect(err).To(MatchError("custom factory called"))
+	})
+})
@@ -5,10 +5,14 @@ import (
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
 	"loggregator/buffer"
+	"sync/atomic"
 	"time"
 )
 
 type DumpSink struct {
+	// lastActivity is accessed atomically and comes first to be 64-bit
+	// aligned.
+	lastActivity       int64
 	appId              string
 	logger             *gosteno.Logger
 	messageBuffer      *buffer.DumpableRingBuffer
@@ -19,7 +23,9 @@ type DumpSink struct {
 	inactivityDuration time.Duration
 }
 
-func NewDumpSink(appId string, bufferSize int, givenLogger *gosteno.Logger, timeoutChan chan Sink, inactivityDuration time.Duration) *DumpSink {
+// NewDumpSink creates a sink retaining the last bufferSize messages of the
+// app, within maxBytes bytes unless maxBytes is 0.
+func NewDumpSink(appId string, bufferSize int, maxBytes int, givenLogger *gosteno.Logger, timeoutChan chan Sink, inactivityDuration time.Duration) *DumpSink {
 	inputChan := make(chan *logmessage.Message)
 	passThruChan := make(chan *logmessage.Message)
 	dumpChan := make(chan chan []*logmessage.Message)
@@ -29,11 +35,19 @@ func NewDumpSink(appId string, bufferSize int, givenLogger *gosteno.Logger, time
 		logger:             givenLogger,
 		inputChan:          inputChan,
 		passThruChan:       passThruChan,
-		messageBuffer:      buffer.NewDumpableRingBuffer(passThruChan, bufferSize),
+		messageBuffer:      buffer.NewDumpableRingBuffer(passThruChan, bufferSize, maxBytes),
 		dumpChan:           dumpChan,
 		timeoutChan:        timeoutChan,
 		inactivityDuration: inactivityDuration,
+		lastActivity:       time.Now().UnixNano(),
 	}
+
+	// Nothing reads the output channel of the buffer, so discard it lest it
+	// keeps evicted messages alive.
+	go func() {
+		for _ = range dumpSink.messageBuffer.OutputChannel() {
+		}
+	}()
 	return dumpSink
 }
 
@@ -49,6 +63,7 @@ func (d *DumpSink) Run() {
 				close(d.passThruChan)
 				return
 			}
+			atomic.StoreInt64(&d.lastActivity, time.Now().UnixNano())
 			d.passThruChan <- msg
 		case dump, ok := <-d.dumpChan:
 			if !ok {
@@ -83,8 +98,29 @@ func (d *DumpSink) Identifier() string {
 	return d.appId
 }
 
+// RetainedBytes returns the size of the messages the sink retains.
+func (d *DumpSink) RetainedBytes() int {
+	return d.messageBuffer.ByteCount()
+}
+
+// Shrink evicts the oldest messages of the sink until it retains at most
+// maxBytes and returns the number of bytes it freed.
+func (d *DumpSink) Shrink(maxBytes int) int {
+	return d.messageBuffer.Shrink(maxBytes)
+}
+
+// LastActivity returns when the sink last received a message.
+func (d *DumpSink) LastActivity() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&d.lastActivity))
+}
+
 func (d *DumpSink) Emit() instrumentation.Context {
-	return instrumentation.Context{}
+	return instrumentation.Context{Name: "dumpSink",
+		Metrics: []instrumentation.Metric{
+			instrumentation.Metric{Name: "retainedMessageCount:" + d.appId, Value: d.messageBuffer.Len()},
+			instrumentation.Metric{Name: "retainedByteCount:" + d.appId, Value: d.messageBuffer.ByteCount()},
+		},
+	}
 }
 
 func (d *DumpSink) ShouldReceiveErrors() bool {
@@ -12,7 +12,7 @@ import (
 )
 
 func TestDumpForOneMessage(t *testing.T) {
-	dump := NewDumpSink("myApp", 1, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+	dump := NewDumpSink("myApp", 1, 0, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
 
 	go dump.Run()
 
@@ -25,7 +25,7 @@ func TestDumpForOneMessage(t *testing.T) {
 }
 
 func TestDumpForTwoMessages(t *testing.T) {
-	dump := NewDumpSink("myApp", 2, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+	dump := NewDumpSink("myApp", 2, 0, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
 
 	go dump.Run()
 
@@ -42,9 +42,34 @@ func TestDumpForTwoMessages(t *testing.T) {
 	assert.Equal(t, string(logMessages[1].GetLogMessage().GetMessage()), "2")
 }
 
+func TestDumpSinkKeepsTheNewestMessagesWithinMaxBytes(t *testing.T) {
+	logMessage := messagetesthelpers.NewMessage(t, "1", "appId")
+	messageSize := logMessage.GetRawMessageLength()
+	dump := NewDumpSink("myApp", 10, 2*messageSize, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+
+	go dump.Run()
+
+	dump.Channel() <- logMessage
+	dump.Channel() <- messagetesthelpers.NewMessage(t, "2", "appId")
+	dump.Channel() <- messagetesthelpers.NewMessage(t, "3", "appId")
+
+	runtime.Gosched()
+
+	logMessages := dump.Dump()
+	assert.Equal(t, len(logMessages), 2)
+	assert.Equal(t, string(logMessages[0].GetLogMessage().GetMessage()), "2")
+	assert.Equal(t, string(logMessages[1].GetLogMessage().GetMessage()), "3")
+
+	metrics := dump.Emit().Metrics
+	assert.Equal(t, metrics[0].Name, "retainedMessageCount:myApp")
+	assert.Equal(t, metrics[0].Value, 2)
+	assert.Equal(t, metrics[1].Name, "retainedByteCount:myApp")
+	assert.Equal(t, metrics[1].Value, 2*messageSize)
+}
+
 func TestTheDumpSinkNeverFillsUp(t *testing.T) {
 	bufferSize := 3
-	dump := NewDumpSink("myApp", bufferSize, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+	dump := NewDumpSink("myApp", bufferSize, 0, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
 
 	go dump.Run()
 
@@ -56,7 +81,7 @@ func TestTheDumpSinkNeverFillsUp(t *testing.T) {
 }
 
 func TestDumpAlwaysReturnsTheNewestMessages(t *testing.T) {
-	dump := NewDumpSink("myApp", 2, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+	dump := NewDumpSink("myApp", 2, 0, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
 
 	go dump.Run()
 
@@ -76,7 +101,7 @@ func TestDumpAlwaysReturnsTheNewestMessages(t *testing.T) {
 }
 
 func TestDumpReturnsAllRecentMessagesToMultipleDumpRequests(t *testing.T) {
-	dump := NewDumpSink("myApp", 2, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+	dump := NewDumpSink("myApp", 2, 0, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
 
 	go dump.Run()
 
@@ -101,7 +126,7 @@ func TestDumpReturnsAllRecentMessagesToMultipleDumpRequests(t *testing.T) {
 }
 
 func TestDumpReturnsAllRecentMessagesToMultipleDumpRequestsWithMessagesCloningInInTheMeantime(t *testing.T) {
-	dump := NewDumpSink("myApp", 2, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+	dump := NewDumpSink("myApp", 2, 0, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
 
 	go dump.Run()
 
@@ -131,7 +156,7 @@ func TestDumpReturnsAllRecentMessagesToMultipleDumpRequestsWithMessagesCloningIn
 }
 
 func TestDumpWithLotsOfMessages(t *testing.T) {
-	dump := NewDumpSink("myApp", 2, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+	dump := NewDumpSink("myApp", 2, 0, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
 
 	go dump.Run()
 
@@ -166,7 +191,7 @@ func TestDumpWithLotsOfMessages(t *testing.T) {
 }
 
 func TestDumpWithLotsOfMessagesAndLargeBuffer(t *testing.T) {
-	dump := NewDumpSink("myApp", 200, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+	dump := NewDumpSink("myApp", 200, 0, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
 
 	go dump.Run()
 
@@ -201,7 +226,7 @@ func TestDumpWithLotsOfMessagesAndLargeBuffer(t *testing.T) {
 }
 
 func TestDumpWithLotsOfMessagesAndLargeBuffer2(t *testing.T) {
-	dump := NewDumpSink("myApp", 200, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+	dump := NewDumpSink("myApp", 200, 0, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
 	go dump.Run()
 
 	for i := 0; i < 100; i++ {
@@ -243,7 +268,7 @@ func TestDumpWithLotsOfMessagesAndLargeBuffer2(t *testing.T) {
 
 func TestDumpWithLotsOfDumps(t *testing.T) {
 	runtime.GOMAXPROCS(runtime.NumCPU())
-	dump := NewDumpSink("myApp", 5, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+	dump := NewDumpSink("myApp", 5, 0, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
 	go dump.Run()
 
 	for i := 0; i < 10; i++ {
@@ -265,7 +290,7 @@ func TestDumpWithLotsOfDumps(t *testing.T) {
 }
 
 func TestClosingInputChanAlsoClosesPassThruChan(t *testing.T) {
-	dump := NewDumpSink("myApp", 5, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
+	dump := NewDumpSink("myApp", 5, 0, loggertesthelper.Logger(), make(chan Sink, 1), time.Second)
 	go dump.Run()
 
 	close(dump.Channel())
@@ -280,7 +305,7 @@ func TestClosingInputChanAlsoClosesPassThruChan(t *testing.T) {
 
 func TestDumpSinkClosesItselfAfterPeriodOfInactivity(t *testing.T) {
 	timeoutChan := make(chan Sink, 1)
-	dump := NewDumpSink("myApp", 5, loggertesthelper.Logger(), timeoutChan, 10*time.Millisecond)
+	dump := NewDumpSink("myApp", 5, 0, loggertesthelper.Logger(), timeoutChan, 10*time.Millisecond)
 	wait := sync.WaitGroup{}
 	wait.Add(1)
 	go func() {
@@ -305,7 +330,7 @@ func TestDumpSinkClosesItselfAfterPeriodOfInactivity(t *testing.T) {
 // TODO: this test is very prone to race conditions and timing issues on slow boxes (ie travis)
 func xTestDumpSinkClosingTimeIsResetWhenAMessageArrives(t *testing.T) {
 	timeoutChan := make(chan Sink, 1)
-	dump := NewDumpSink("myApp", 5, loggertesthelper.Logger(), timeoutChan, 10*time.Millisecond)
+	dump := NewDumpSink("myApp", 5, 0, loggertesthelper.Logger(), timeoutChan, 10*time.Millisecond)
 	go dump.Run()
 
 	time.Sleep(5 * time.Millisecond)
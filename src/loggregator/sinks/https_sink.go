@@ -0,0 +1,276 @@
+package sinks
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"github.com/cloudfoundry/gosteno"
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"loggregator/buffer/truncatingbuffer"
+	"loggregator/dropcounter"
+	"loggregator/sinks/retrystrategy"
+	"loggregator/sinks/syslogwriter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	httpsMaxRetries       = 16
+	httpsMaxRetryDuration = 10 * time.Second
+	httpsMaxBatchSize     = 64 * 1024
+	httpsFlushInterval    = time.Second
+)
+
+type HttpsSink struct {
+	logger                    *gosteno.Logger
+	appId                     string
+	drainUrl                  string
+	client                    *http.Client
+	maxBatchSize              int
+	flushInterval             time.Duration
+	backoffStrategy           retrystrategy.RetryStrategy
+	maxRetryDuration          time.Duration
+	sentMessageCount          *uint64
+	sentByteCount             *uint64
+	droppedMessageCount       *uint64
+	bufferDroppedMessageCount *uint64
+	overflowPolicy            truncatingbuffer.Policy
+	appDroppedMessages        *dropcounter.Counter
+	listenerChannel           chan *logmessage.Message
+	errorChannel              chan<- *logmessage.Message
+	disconnectChannel         chan int
+	disconnectOnce            sync.Once
+	connected                 *uint32
+	health                    drainHealth
+}
+
+// NewHttpsSink creates a drain that POSTs batches of octet counted RFC5424
+// frames to drainUrl, the way Heroku's HTTPS drains do. A batch is sent once
+// it reaches maxBatchSize bytes or flushInterval has passed. Failed POSTs are
+// retried as told by backoffStrategy, for up to httpsMaxRetryDuration per
+// batch so a failing drain holds up its messages only that long. Messages
+// that pile up meanwhile are dropped as told by overflowPolicy and counted in
+// appDroppedMessages.
+func NewHttpsSink(appId string, drainUrl string, givenLogger *gosteno.Logger, skipCertVerify bool, maxBatchSize int, flushInterval time.Duration, backoffStrategy retrystrategy.RetryStrategy, errorChannel chan<- *logmessage.Message, overflowPolicy truncatingbuffer.Policy, appDroppedMessages *dropcounter.Counter) Drain {
+	givenLogger.Debugf("Https Sink %s: Created for appId [%s]", drainUrl, appId)
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: skipCertVerify},
+	}
+	return &HttpsSink{
+		appId:                     appId,
+		drainUrl:                  drainUrl,
+		logger:                    givenLogger,
+		client:                    &http.Client{Transport: transport},
+		maxBatchSize:              maxBatchSize,
+		flushInterval:             flushInterval,
+		backoffStrategy:           backoffStrategy,
+		maxRetryDuration:          httpsMaxRetryDuration,
+		sentMessageCount:          new(uint64),
+		sentByteCount:             new(uint64),
+		droppedMessageCount:       new(uint64),
+		bufferDroppedMessageCount: new(uint64),
+		overflowPolicy:            overflowPolicy,
+		appDroppedMessages:        appDroppedMessages,
+		listenerChannel:           make(chan *logmessage.Message),
+		errorChannel:              errorChannel,
+		disconnectChannel:         make(chan int),
+		connected:                 new(uint32),
+	}
+}
+
+func newHttpsDrain(appId string, drainUrl string, parsedUrl *url.URL, config DrainConfig, logger *gosteno.Logger, errorChannel chan<- *logmessage.Message) (Drain, error) {
+	backoffStrategy, err := newRetryStrategy(parsedUrl, config)
+	if err != nil {
+		return nil, err
+	}
+	overflowPolicy, err := newOverflowPolicy(parsedUrl, config.HttpsOverflowPolicy, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewHttpsSink(appId, drainUrl, logger, config.SkipCertVerify, httpsMaxBatchSize, httpsFlushInterval, backoffStrategy, errorChannel, overflowPolicy, config.AppDroppedMessages), nil
+}
+
+func (s *HttpsSink) Run() {
+	s.logger.Infof("Https Sink %s: Running.", s.drainUrl)
+	defer s.logger.Infof("Https Sink %s: Stopped.", s.drainUrl)
+
+	batch := &bytes.Buffer{}
+	batchCount := 0
+	flush := func() {
+		if batchCount > 0 {
+			s.post(batch.Bytes(), batchCount)
+			batch.Reset()
+			batchCount = 0
+		}
+	}
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	buffer := runTruncatingBuffer(s, 100, s.overflowPolicy, s.bufferDroppedMessageCount, s.appDroppedMessages, s.Logger())
+	for {
+		select {
+		case <-s.disconnectChannel:
+			return
+		case <-ticker.C:
+			flush()
+		case message, ok := <-buffer.GetOutputChannel():
+			if !ok {
+				s.logger.Debugf("Https Sink %s: Closed listener channel detected. Flushing and closing.", s.drainUrl)
+				flush()
+				return
+			}
+
+			batch.WriteString(formatHttpsFrame(message.GetLogMessage()))
+			batchCount++
+			if batch.Len() >= s.maxBatchSize {
+				flush()
+			}
+		}
+	}
+}
+
+func (s *HttpsSink) post(body []byte, messageCount int) {
+	var err error
+	backoff := time.Duration(0)
+	giveUp := time.Now().Add(s.maxRetryDuration)
+	for numberOfTries := 0; numberOfTries < httpsMaxRetries; numberOfTries++ {
+		select {
+		case <-s.disconnectChannel:
+			atomic.AddUint64(s.droppedMessageCount, uint64(messageCount))
+			return
+		case <-time.After(backoff):
+		}
+
+		var retry bool
+		retry, err = s.send(body, messageCount)
+		s.setConnected(err == nil)
+		if err == nil {
+			s.health.succeeded()
+			s.logger.Debugf("Https Sink %s: Successfully sent %d messages", s.drainUrl, messageCount)
+			atomic.AddUint64(s.sentMessageCount, uint64(messageCount))
+			atomic.AddUint64(s.sentByteCount, uint64(len(body)))
+			return
+		}
+		if !retry {
+			s.health.failed(err, 0)
+			break
+		}
+		backoff = s.backoffStrategy(numberOfTries + 1)
+		s.health.failed(err, backoff)
+		if time.Now().Add(backoff).After(giveUp) {
+			break
+		}
+		s.logger.Debugf("Https Sink %s: Error when posting data. Backing off for %v. Err: %v", s.drainUrl, backoff, err)
+	}
+
+	atomic.AddUint64(s.droppedMessageCount, uint64(messageCount))
+	s.sendError(fmt.Sprintf("Https Sink %s: Dropped %d messages. Err: %v", s.drainUrl, messageCount, err))
+}
+
+// send performs a single POST and reports whether a failure is worth retrying.
+func (s *HttpsSink) send(body []byte, messageCount int) (bool, error) {
+	request, err := http.NewRequest("POST", s.drainUrl, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/logplex-1")
+	request.Header.Set("Logplex-Msg-Count", strconv.Itoa(messageCount))
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	response.Body.Close()
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return false, nil
+	case response.StatusCode >= 500:
+		return true, fmt.Errorf("Drain responded with %s", response.Status)
+	default:
+		return false, fmt.Errorf("Drain responded with %s", response.Status)
+	}
+}
+
+func (s *HttpsSink) sendError(errorMsg string) {
+	s.logger.Warnf(errorMsg)
+	logMessage, err := logmessage.GenerateMessage(logmessage.LogMessage_ERR, errorMsg, s.appId, "LGR")
+	if err == nil {
+		s.errorChannel <- logMessage
+	} else {
+		s.logger.Warnf("Error marshalling message: %v", err)
+	}
+}
+
+func (s *HttpsSink) Channel() chan *logmessage.Message {
+	return s.listenerChannel
+}
+
+func (s *HttpsSink) Disconnect() {
+	s.disconnectOnce.Do(func() {
+		close(s.disconnectChannel)
+	})
+}
+
+func (s *HttpsSink) DrainType() string {
+	return "https"
+}
+
+// IsConnected reports whether the last POST to the drain succeeded.
+func (s *HttpsSink) IsConnected() bool {
+	return atomic.LoadUint32(s.connected) == 1
+}
+
+func (s *HttpsSink) setConnected(connected bool) {
+	var value uint32
+	if connected {
+		value = 1
+	}
+	atomic.StoreUint32(s.connected, value)
+}
+
+func (s *HttpsSink) Status() DrainStatus {
+	dropped := atomic.LoadUint64(s.droppedMessageCount) + atomic.LoadUint64(s.bufferDroppedMessageCount)
+	return s.health.status(s, atomic.LoadUint64(s.sentMessageCount), dropped)
+}
+
+func (s *HttpsSink) Logger() *gosteno.Logger {
+	return s.logger
+}
+
+func (s *HttpsSink) Identifier() string {
+	return s.drainUrl
+}
+
+func (s *HttpsSink) AppId() string {
+	return s.appId
+}
+
+func (s *HttpsSink) ShouldReceiveErrors() bool {
+	return false
+}
+
+func (s *HttpsSink) Emit() instrumentation.Context {
+	return instrumentation.Context{Name: "httpsSink",
+		Metrics: []instrumentation.Metric{
+			instrumentation.Metric{Name: "sentMessageCount:" + s.appId, Value: atomic.LoadUint64(s.sentMessageCount)},
+			instrumentation.Metric{Name: "sentByteCount:" + s.appId, Value: atomic.LoadUint64(s.sentByteCount)},
+			instrumentation.Metric{Name: "droppedMessageCount:" + s.appId, Value: atomic.LoadUint64(s.droppedMessageCount)},
+			bufferDroppedMessageCountMetric(s.overflowPolicy, s.appId, s.bufferDroppedMessageCount),
+		},
+	}
+}
+
+func formatHttpsFrame(logMessage *logmessage.LogMessage) string {
+	priority := syslogwriter.PriorityStdout
+	if logMessage.GetMessageType() == logmessage.LogMessage_ERR {
+		priority = syslogwriter.PriorityStderr
+	}
+	return syslogwriter.FormatFrame(priority, logMessage.GetAppId(), logMessage.GetSourceName(), logMessage.GetSourceId(), string(logMessage.GetMessage()), logMessage.GetTimestamp())
+}
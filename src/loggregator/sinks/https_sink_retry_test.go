@@ -0,0 +1,43 @@
+package sinks
+
+import (
+	"github.com/cloudfoundry/loggregatorlib/loggertesthelper"
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	messagetesthelpers "github.com/cloudfoundry/loggregatorlib/logmessage/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"loggregator/buffer/truncatingbuffer"
+	"loggregator/sinks/retrystrategy"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHttpsSinkGivesUpOnABatchWhenTheDrainKeepsFailing(t *testing.T) {
+	requestCount := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requestCount, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	errorChannel := make(chan *logmessage.Message, 10)
+	sink := NewHttpsSink("appId", server.URL, loggertesthelper.Logger(), true, 1, 10*time.Millisecond, retrystrategy.NewFixedIntervalRetryStrategy(50*time.Millisecond), errorChannel, truncatingbuffer.Policy{}, nil).(*HttpsSink)
+	sink.maxRetryDuration = 120 * time.Millisecond
+	go sink.Run()
+	defer close(sink.Channel())
+
+	start := time.Now()
+	sink.Channel() <- messagetesthelpers.NewMessage(t, "message", "appId")
+
+	select {
+	case errorMessage := <-errorChannel:
+		assert.True(t, strings.Contains(string(errorMessage.GetLogMessage().GetMessage()), "Dropped 1 messages"))
+	case <-time.After(time.Second):
+		t.Fatal("Expected the batch to be dropped")
+	}
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+	assert.True(t, atomic.LoadInt32(requestCount) <= 3)
+}
@@ -0,0 +1,125 @@
+package sinks_test
+
+import (
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"github.com/cloudfoundry/loggregatorlib/loggertesthelper"
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"loggregator/buffer/truncatingbuffer"
+	"loggregator/sinks"
+	"loggregator/sinks/retrystrategy"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+type drainRequest struct {
+	body         string
+	contentType  string
+	messageCount string
+}
+
+type drainHandler struct {
+	requests     chan drainRequest
+	statusCodes  []int
+	requestCount int
+	sync.Mutex
+}
+
+func (h *drainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Lock()
+	statusCode := http.StatusOK
+	if h.requestCount < len(h.statusCodes) {
+		statusCode = h.statusCodes[h.requestCount]
+	}
+	h.requestCount++
+	h.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	w.WriteHeader(statusCode)
+	h.requests <- drainRequest{
+		body:         string(body),
+		contentType:  r.Header.Get("Content-Type"),
+		messageCount: r.Header.Get("Logplex-Msg-Count"),
+	}
+}
+
+var _ = Describe("HttpsSink", func() {
+	var handler *drainHandler
+	var server *httptest.Server
+	var errorChannel chan *logmessage.Message
+	var httpsSink sinks.Sink
+
+	newHttpsSink := func(maxBatchSize int, flushInterval time.Duration) {
+		httpsSink = sinks.NewHttpsSink("appId", server.URL, loggertesthelper.Logger(), true, maxBatchSize, flushInterval, retrystrategy.NewExponentialRetryStrategy(), errorChannel, truncatingbuffer.Policy{}, nil)
+		go httpsSink.Run()
+	}
+
+	BeforeEach(func() {
+		handler = &drainHandler{requests: make(chan drainRequest, 20)}
+		server = httptest.NewServer(handler)
+		errorChannel = make(chan *logmessage.Message, 10)
+	})
+
+	AfterEach(func() {
+		close(httpsSink.Channel())
+		server.Close()
+	})
+
+	It("should batch messages into a single POST after the flush interval", func(done Done) {
+		newHttpsSink(64*1024, 50*time.Millisecond)
+
+		httpsSink.Channel() <- NewMessage("message 1", "appId")
+		httpsSink.Channel() <- NewMessage("message 2", "appId")
+
+		request := <-handler.requests
+		Expect(request.contentType).To(Equal("application/logplex-1"))
+		Expect(request.messageCount).To(Equal("2"))
+		Expect(request.body).To(MatchRegexp(`^\d+ <14>1 \S+ loggregator appId \[App/\] - - message 1\n\d+ <14>1 \S+ loggregator appId \[App/\] - - message 2\n$`))
+		close(done)
+	})
+
+	It("should flush as soon as the batch reaches the size threshold", func(done Done) {
+		newHttpsSink(1, time.Hour)
+
+		httpsSink.Channel() <- NewMessage("message 1", "appId")
+
+		request := <-handler.requests
+		Expect(request.messageCount).To(Equal("1"))
+		close(done)
+	})
+
+	It("should retry when the drain responds with a 5xx", func(done Done) {
+		handler.statusCodes = []int{http.StatusServiceUnavailable, http.StatusInternalServerError}
+		newHttpsSink(1, time.Hour)
+
+		httpsSink.Channel() <- NewMessage("message 1", "appId")
+
+		for i := 0; i < 3; i++ {
+			request := <-handler.requests
+			Expect(request.body).To(MatchRegexp("message 1"))
+		}
+
+		Eventually(func() []instrumentation.Metric { return httpsSink.Emit().Metrics }).Should(ContainElement(instrumentation.Metric{Name: "sentMessageCount:appId", Value: uint64(1)}))
+		close(done)
+	})
+
+	It("should drop the batch when the drain rejects it", func(done Done) {
+		handler.statusCodes = []int{http.StatusBadRequest}
+		newHttpsSink(1, time.Hour)
+
+		httpsSink.Channel() <- NewMessage("message 1", "appId")
+
+		errorLog := <-errorChannel
+		Expect(string(errorLog.GetLogMessage().GetMessage())).To(MatchRegexp("Dropped 1 messages. Err: Drain responded with 400 Bad Request"))
+		Expect(errorLog.GetLogMessage().GetSourceName()).To(Equal("LGR"))
+
+		metrics := httpsSink.Emit().Metrics
+		Expect(metrics).To(ContainElement(instrumentation.Metric{Name: "sentMessageCount:appId", Value: uint64(0)}))
+		Expect(metrics).To(ContainElement(instrumentation.Metric{Name: "droppedMessageCount:appId", Value: uint64(1)}))
+		close(done)
+	})
+})
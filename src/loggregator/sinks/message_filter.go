@@ -0,0 +1,107 @@
+package sinks
+
+import (
+	"fmt"
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"net/url"
+	"strings"
+)
+
+// MessageFilter selects the messages a drain forwards. It is configured
+// through the query of the drain URL, for example
+// ?types=err&sources=App,RTR&exclude_sources=STG&instances=0,1
+// Every parameter takes a comma separated list and all of them have to match.
+type MessageFilter struct {
+	messageTypes    map[logmessage.LogMessage_MessageType]bool
+	sources         map[string]bool
+	excludedSources map[string]bool
+	instances       map[string]bool
+}
+
+// NewMessageFilter returns nil if the query has no filter parameters.
+func NewMessageFilter(query url.Values) (*MessageFilter, error) {
+	types := filterValues(query, "types")
+	sources := filterValues(query, "sources")
+	excludedSources := filterValues(query, "exclude_sources")
+	instances := filterValues(query, "instances")
+	if types == nil && sources == nil && excludedSources == nil && instances == nil {
+		return nil, nil
+	}
+
+	filter := &MessageFilter{
+		sources:         toLowerSet(sources),
+		excludedSources: toLowerSet(excludedSources),
+		instances:       toSet(instances),
+	}
+
+	if types != nil {
+		filter.messageTypes = make(map[logmessage.LogMessage_MessageType]bool)
+		for _, messageType := range types {
+			switch strings.ToLower(messageType) {
+			case "out":
+				filter.messageTypes[logmessage.LogMessage_OUT] = true
+			case "err":
+				filter.messageTypes[logmessage.LogMessage_ERR] = true
+			default:
+				return nil, fmt.Errorf("Invalid message type in types filter: %s", messageType)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// Allows reports whether a drain with this filter forwards logMessage. A nil
+// filter allows every message.
+func (filter *MessageFilter) Allows(logMessage *logmessage.LogMessage) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.messageTypes != nil && !filter.messageTypes[logMessage.GetMessageType()] {
+		return false
+	}
+
+	sourceName := strings.ToLower(logMessage.GetSourceName())
+	if filter.sources != nil && !filter.sources[sourceName] {
+		return false
+	}
+	if filter.excludedSources[sourceName] {
+		return false
+	}
+
+	return filter.instances == nil || filter.instances[logMessage.GetSourceId()]
+}
+
+func filterValues(query url.Values, key string) []string {
+	var values []string
+	for _, value := range query[key] {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+func toSet(values []string) map[string]bool {
+	if values == nil {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+func toLowerSet(values []string) map[string]bool {
+	if values == nil {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[strings.ToLower(value)] = true
+	}
+	return set
+}
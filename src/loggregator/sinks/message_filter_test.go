@@ -0,0 +1,71 @@
+package sinks_test
+
+import (
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"loggregator/sinks"
+	"net/url"
+)
+
+var _ = Describe("MessageFilter", func() {
+	newFilter := func(query string) *sinks.MessageFilter {
+		values, err := url.ParseQuery(query)
+		Expect(err).ToNot(HaveOccurred())
+		filter, err := sinks.NewMessageFilter(values)
+		Expect(err).ToNot(HaveOccurred())
+		return filter
+	}
+
+	stdout := func(sourceName, sourceId string) *logmessage.LogMessage {
+		return generateLogMessage("message", "appId", logmessage.LogMessage_OUT, sourceName, sourceId)
+	}
+
+	stderr := func(sourceName, sourceId string) *logmessage.LogMessage {
+		return generateLogMessage("message", "appId", logmessage.LogMessage_ERR, sourceName, sourceId)
+	}
+
+	It("should not create a filter without filter parameters", func() {
+		filter := newFilter("retry=fixed&types=")
+		Expect(filter).To(BeNil())
+		Expect(filter.Allows(stdout("App", "0"))).To(BeTrue())
+	})
+
+	It("should filter by message type", func() {
+		filter := newFilter("types=err")
+		Expect(filter.Allows(stderr("App", "0"))).To(BeTrue())
+		Expect(filter.Allows(stdout("App", "0"))).To(BeFalse())
+	})
+
+	It("should filter by source name regardless of case", func() {
+		filter := newFilter("sources=App,rtr")
+		Expect(filter.Allows(stdout("App", "0"))).To(BeTrue())
+		Expect(filter.Allows(stdout("RTR", ""))).To(BeTrue())
+		Expect(filter.Allows(stdout("STG", "0"))).To(BeFalse())
+	})
+
+	It("should leave out excluded sources", func() {
+		filter := newFilter("exclude_sources=STG")
+		Expect(filter.Allows(stdout("App", "0"))).To(BeTrue())
+		Expect(filter.Allows(stdout("STG", "0"))).To(BeFalse())
+	})
+
+	It("should filter by instance", func() {
+		filter := newFilter("instances=0,1")
+		Expect(filter.Allows(stdout("App", "1"))).To(BeTrue())
+		Expect(filter.Allows(stdout("App", "2"))).To(BeFalse())
+	})
+
+	It("should require all parameters to match", func() {
+		filter := newFilter("types=err&sources=App,RTR&instances=0,1")
+		Expect(filter.Allows(stderr("App", "0"))).To(BeTrue())
+		Expect(filter.Allows(stdout("App", "0"))).To(BeFalse())
+		Expect(filter.Allows(stderr("DEA", "0"))).To(BeFalse())
+		Expect(filter.Allows(stderr("App", "3"))).To(BeFalse())
+	})
+
+	It("should reject unknown message types", func() {
+		_, err := sinks.NewMessageFilter(url.Values{"types": []string{"debug"}})
+		Expect(err).To(MatchError("Invalid message type in types filter: debug"))
+	})
+})
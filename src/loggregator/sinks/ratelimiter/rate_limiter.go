@@ -0,0 +1,169 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket holds up to one second worth of tokens and refills at rate
+// tokens per second. A zero rate means unlimited.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+// allows reports whether n tokens can be taken. A request larger than the
+// capacity of the bucket is allowed once the bucket is full, so that it does
+// not starve forever.
+func (b *tokenBucket) allows(n float64) bool {
+	if b.rate == 0 {
+		return true
+	}
+	return b.tokens >= n || b.tokens >= b.rate
+}
+
+func (b *tokenBucket) take(n float64) {
+	if b.rate == 0 {
+		return
+	}
+	b.tokens -= n
+	if b.tokens < 0 {
+		b.tokens = 0
+	}
+}
+
+// Limiter limits the number of messages and bytes per second. A message is
+// only allowed if the parent limiter, if any, allows it as well.
+type Limiter struct {
+	messages *tokenBucket
+	bytes    *tokenBucket
+	parent   *Limiter
+	sync.Mutex
+}
+
+// New returns nil, which allows everything, if there are neither limits
+// nor a parent.
+func New(messagesPerSecond float64, bytesPerSecond float64, parent *Limiter) *Limiter {
+	if messagesPerSecond <= 0 && bytesPerSecond <= 0 && parent == nil {
+		return nil
+	}
+	return &Limiter{
+		messages: newTokenBucket(positive(messagesPerSecond)),
+		bytes:    newTokenBucket(positive(bytesPerSecond)),
+		parent:   parent,
+	}
+}
+
+// Allow reports whether a message of size bytes is within the limits and
+// accounts for it if it is.
+func (l *Limiter) Allow(size int) bool {
+	if l == nil {
+		return true
+	}
+	return l.allow(float64(size), time.Now())
+}
+
+func (l *Limiter) allow(size float64, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	l.messages.refill(now)
+	l.bytes.refill(now)
+	if !l.messages.allows(1) || !l.bytes.allows(size) {
+		return false
+	}
+	if l.parent != nil && !l.parent.allow(size, now) {
+		return false
+	}
+
+	l.messages.take(1)
+	l.bytes.take(size)
+	return true
+}
+
+func positive(value float64) float64 {
+	if value < 0 {
+		return 0
+	}
+	return value
+}
+
+// Registry hands out one Limiter per key, e.g. per app, for as long as
+// somebody holds on to it.
+type Registry struct {
+	messagesPerSecond float64
+	bytesPerSecond    float64
+	limiters          map[string]*registeredLimiter
+	sync.Mutex
+}
+
+type registeredLimiter struct {
+	limiter    *Limiter
+	references int
+}
+
+func NewRegistry(messagesPerSecond float64, bytesPerSecond float64) *Registry {
+	return &Registry{
+		messagesPerSecond: messagesPerSecond,
+		bytesPerSecond:    bytesPerSecond,
+		limiters:          make(map[string]*registeredLimiter),
+	}
+}
+
+// Acquire returns the limiter for key. Every call has to be paired with a
+// call to Release. It returns nil if the registry has no limits.
+func (r *Registry) Acquire(key string) *Limiter {
+	if r == nil || (r.messagesPerSecond <= 0 && r.bytesPerSecond <= 0) {
+		return nil
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	registered, ok := r.limiters[key]
+	if !ok {
+		registered = &registeredLimiter{limiter: New(r.messagesPerSecond, r.bytesPerSecond, nil)}
+		r.limiters[key] = registered
+	}
+	registered.references++
+	return registered.limiter
+}
+
+func (r *Registry) Release(key string) {
+	if r == nil {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	registered, ok := r.limiters[key]
+	if !ok {
+		return
+	}
+	registered.references--
+	if registered.references <= 0 {
+		delete(r.limiters, key)
+	}
+}
+
+// Len returns the number of keys with a limiter.
+func (r *Registry) Len() int {
+	r.Lock()
+	defer r.Unlock()
+
+	return len(r.limiters)
+}
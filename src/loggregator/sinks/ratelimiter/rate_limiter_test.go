@@ -0,0 +1,79 @@
+package ratelimiter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"loggregator/sinks/ratelimiter"
+	"time"
+)
+
+var _ = Describe("Limiter", func() {
+	allowed := func(limiter *ratelimiter.Limiter, count int, size int) int {
+		n := 0
+		for i := 0; i < count; i++ {
+			if limiter.Allow(size) {
+				n++
+			}
+		}
+		return n
+	}
+
+	It("should allow everything without limits", func() {
+		limiter := ratelimiter.New(0, 0, nil)
+		Expect(limiter).To(BeNil())
+		Expect(allowed(limiter, 1000, 1000)).To(Equal(1000))
+	})
+
+	It("should limit messages per second", func() {
+		limiter := ratelimiter.New(10, 0, nil)
+		Expect(allowed(limiter, 20, 100)).To(Equal(10))
+
+		time.Sleep(200 * time.Millisecond)
+		Expect(allowed(limiter, 20, 100)).To(BeNumerically("~", 2, 1))
+	})
+
+	It("should limit bytes per second", func() {
+		limiter := ratelimiter.New(0, 1000, nil)
+		Expect(allowed(limiter, 20, 100)).To(Equal(10))
+	})
+
+	It("should let a message larger than the byte limit through when the bucket is full", func() {
+		limiter := ratelimiter.New(0, 100, nil)
+		Expect(limiter.Allow(500)).To(BeTrue())
+		Expect(limiter.Allow(1)).To(BeFalse())
+	})
+
+	It("should apply the limits of the parent as well", func() {
+		parent := ratelimiter.New(5, 0, nil)
+		first := ratelimiter.New(10, 0, parent)
+		second := ratelimiter.New(10, 0, parent)
+
+		Expect(allowed(first, 3, 1)).To(Equal(3))
+		Expect(allowed(second, 3, 1)).To(Equal(2))
+		Expect(allowed(first, 3, 1)).To(Equal(0))
+	})
+})
+
+var _ = Describe("Registry", func() {
+	It("should share limiters per key until they are released", func() {
+		registry := ratelimiter.NewRegistry(10, 0)
+
+		limiter := registry.Acquire("app")
+		Expect(registry.Acquire("app") == limiter).To(BeTrue())
+		Expect(registry.Acquire("other app") == limiter).To(BeFalse())
+		Expect(registry.Len()).To(Equal(2))
+
+		registry.Release("app")
+		Expect(registry.Len()).To(Equal(2))
+		registry.Release("app")
+		registry.Release("other app")
+		Expect(registry.Len()).To(Equal(0))
+	})
+
+	It("should not hand out limiters without limits", func() {
+		registry := ratelimiter.NewRegistry(0, 0)
+		Expect(registry.Acquire("app")).To(BeNil())
+		registry.Release("app")
+		Expect(registry.Len()).To(Equal(0))
+	})
+})
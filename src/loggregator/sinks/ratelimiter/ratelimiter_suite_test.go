@@ -0,0 +1,13 @@
+package ratelimiter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestRatelimiter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ratelimiter Suite")
+}
@@ -1,6 +1,7 @@
 package retrystrategy
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
 	"time"
@@ -23,3 +24,118 @@ func NewExponentialRetryStrategy() RetryStrategy {
 	}
 	return exponential
 }
+
+const (
+	Exponential        = "exponential"
+	CappedExponential  = "capped-exponential"
+	DecorrelatedJitter = "decorrelated-jitter"
+	FixedInterval      = "fixed"
+)
+
+// The smallest delay decorrelated jitter waits, same as the first step of
+// the exponential strategy.
+const decorrelatedJitterBaseDelay = time.Millisecond
+
+// New raises shorter intervals and maximum delays to MinInterval and
+// MinMaxDelay, so a drain that keeps failing cannot redial in a hot loop.
+const (
+	MinInterval = 100 * time.Millisecond
+	MinMaxDelay = time.Second
+)
+
+// NewCappedExponentialRetryStrategy backs off like the exponential strategy
+// but never waits longer than maxDelay.
+func NewCappedExponentialRetryStrategy(maxDelay time.Duration) RetryStrategy {
+	exponential := NewExponentialRetryStrategy()
+	return func(counter int) time.Duration {
+		delay := exponential(counter)
+		if delay > maxDelay {
+			return maxDelay
+		}
+		return delay
+	}
+}
+
+// NewDecorrelatedJitterRetryStrategy picks every delay at random between the
+// base delay and three times the previous delay, capped at maxDelay. The
+// returned strategy keeps state: it returns the same delay when asked for
+// the same counter twice in a row and starts over at counter 0, so it must
+// not be shared between drains.
+func NewDecorrelatedJitterRetryStrategy(maxDelay time.Duration) RetryStrategy {
+	previous := decorrelatedJitterBaseDelay
+	lastCounter := 0
+	return func(counter int) time.Duration {
+		if counter == 0 {
+			previous = decorrelatedJitterBaseDelay
+			lastCounter = 0
+			return time.Duration(0)
+		}
+		if counter == lastCounter {
+			return previous
+		}
+
+		upper := previous * 3
+		if upper > maxDelay {
+			upper = maxDelay
+		}
+		delay := decorrelatedJitterBaseDelay
+		if upper > decorrelatedJitterBaseDelay {
+			delay += time.Duration(rand.Int63n(int64(upper - decorrelatedJitterBaseDelay)))
+		}
+		previous = delay
+		lastCounter = counter
+		return delay
+	}
+}
+
+// NewFixedIntervalRetryStrategy always waits interval between retries.
+func NewFixedIntervalRetryStrategy(interval time.Duration) RetryStrategy {
+	return func(counter int) time.Duration {
+		if counter == 0 {
+			return time.Duration(0)
+		}
+		return interval
+	}
+}
+
+// NewAtLeastRetryStrategy waits as long as strategy, but never less than
+// floor would for the same attempt.
+func NewAtLeastRetryStrategy(strategy RetryStrategy, floor RetryStrategy) RetryStrategy {
+	return func(counter int) time.Duration {
+		delay := strategy(counter)
+		if minimum := floor(counter); delay < minimum {
+			return minimum
+		}
+		return delay
+	}
+}
+
+// New creates the retry strategy with the given name. maxDelay applies to
+// the capped exponential and decorrelated jitter strategies, interval to the
+// fixed interval strategy. Both are raised to their minimum if need be.
+func New(name string, maxDelay time.Duration, interval time.Duration) (RetryStrategy, error) {
+	switch name {
+	case Exponential, "":
+		return NewExponentialRetryStrategy(), nil
+	case CappedExponential, DecorrelatedJitter:
+		if maxDelay <= 0 {
+			return nil, fmt.Errorf("Retry strategy %s needs a positive maximum delay", name)
+		}
+		if maxDelay < MinMaxDelay {
+			maxDelay = MinMaxDelay
+		}
+		if name == CappedExponential {
+			return NewCappedExponentialRetryStrategy(maxDelay), nil
+		}
+		return NewDecorrelatedJitterRetryStrategy(maxDelay), nil
+	case FixedInterval:
+		if interval <= 0 {
+			return nil, fmt.Errorf("Retry strategy %s needs a positive interval", name)
+		}
+		if interval < MinInterval {
+			interval = MinInterval
+		}
+		return NewFixedIntervalRetryStrategy(interval), nil
+	}
+	return nil, fmt.Errorf("Unknown retry strategy: %s", name)
+}
@@ -64,4 +64,110 @@ var _ = Describe("RetryStrategy", func() {
 			}
 		})
 	})
+
+	Describe("CappedExponentialRetryStrategy", func() {
+		It("should never wait longer than the maximum delay", func() {
+			strategy := retrystrategy.NewCappedExponentialRetryStrategy(time.Second)
+
+			Expect(strategy(0)).To(Equal(time.Duration(0)))
+			Expect(strategy(1).Seconds()).To(BeNumerically("~", 0.001, 0.0005))
+			for counter := 12; counter < 30; counter++ {
+				Expect(strategy(counter)).To(Equal(time.Second))
+			}
+		})
+	})
+
+	Describe("DecorrelatedJitterRetryStrategy", func() {
+		It("should stay between the base delay and the maximum delay", func() {
+			strategy := retrystrategy.NewDecorrelatedJitterRetryStrategy(100 * time.Millisecond)
+
+			Expect(strategy(0)).To(Equal(time.Duration(0)))
+			for counter := 1; counter < 100; counter++ {
+				delay := strategy(counter)
+				Expect(delay).To(BeNumerically(">=", time.Millisecond))
+				Expect(delay).To(BeNumerically("<=", 100*time.Millisecond))
+			}
+		})
+
+		It("should return the same delay when asked for the same counter again", func() {
+			strategy := retrystrategy.NewDecorrelatedJitterRetryStrategy(time.Hour)
+			for counter := 1; counter < 20; counter++ {
+				Expect(strategy(counter)).To(Equal(strategy(counter)))
+			}
+		})
+
+		It("should start over at counter 0", func() {
+			strategy := retrystrategy.NewDecorrelatedJitterRetryStrategy(time.Hour)
+			for counter := 1; counter < 20; counter++ {
+				strategy(counter)
+			}
+
+			strategy(0)
+			Expect(strategy(1)).To(BeNumerically("<", 3*time.Millisecond))
+		})
+	})
+
+	Describe("FixedIntervalRetryStrategy", func() {
+		It("should always wait the interval", func() {
+			strategy := retrystrategy.NewFixedIntervalRetryStrategy(5 * time.Second)
+
+			Expect(strategy(0)).To(Equal(time.Duration(0)))
+			Expect(strategy(1)).To(Equal(5 * time.Second))
+			Expect(strategy(100)).To(Equal(5 * time.Second))
+		})
+	})
+
+	Describe("AtLeastRetryStrategy", func() {
+		It("should wait the longer of both delays", func() {
+			strategy := retrystrategy.NewAtLeastRetryStrategy(retrystrategy.NewFixedIntervalRetryStrategy(time.Second), retrystrategy.NewCappedExponentialRetryStrategy(time.Minute))
+
+			Expect(strategy(0)).To(Equal(time.Duration(0)))
+			Expect(strategy(1)).To(Equal(time.Second))
+			Expect(strategy(20)).To(Equal(time.Minute))
+		})
+	})
+
+	Describe("New", func() {
+		It("should create strategies by name", func() {
+			strategy, err := retrystrategy.New("fixed", 0, time.Second)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strategy(3)).To(Equal(time.Second))
+
+			strategy, err = retrystrategy.New("capped-exponential", time.Second, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strategy(20)).To(Equal(time.Second))
+
+			_, err = retrystrategy.New("exponential", 0, 0)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = retrystrategy.New("decorrelated-jitter", time.Second, 0)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should raise intervals and maximum delays to their minimum", func() {
+			strategy, err := retrystrategy.New("fixed", 0, time.Nanosecond)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strategy(3)).To(Equal(retrystrategy.MinInterval))
+
+			strategy, err = retrystrategy.New("capped-exponential", time.Nanosecond, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strategy(20)).To(Equal(retrystrategy.MinMaxDelay))
+
+			strategy, err = retrystrategy.New("decorrelated-jitter", time.Nanosecond, 0)
+			Expect(err).ToNot(HaveOccurred())
+			for counter := 1; counter < 20; counter++ {
+				Expect(strategy(counter)).To(BeNumerically("<=", retrystrategy.MinMaxDelay))
+			}
+		})
+
+		It("should reject unknown strategies and missing settings", func() {
+			_, err := retrystrategy.New("linear", time.Second, time.Second)
+			Expect(err).To(MatchError("Unknown retry strategy: linear"))
+
+			_, err = retrystrategy.New("fixed", time.Second, 0)
+			Expect(err).To(HaveOccurred())
+
+			_, err = retrystrategy.New("decorrelated-jitter", 0, time.Second)
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
@@ -6,6 +6,8 @@ import (
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
 	"loggregator/buffer"
 	"loggregator/buffer/truncatingbuffer"
+	"loggregator/dropcounter"
+	"sync/atomic"
 )
 
 type Sink interface {
@@ -28,8 +30,19 @@ func RequestClose(sink Sink, sinkCloseChan chan Sink, alreadyRequestedClose *boo
 	}
 }
 
-func runTruncatingBuffer(sink Sink, bufferSize uint, logger *gosteno.Logger) buffer.MessageBuffer {
-	b := truncatingbuffer.NewTruncatingBuffer(sink.Channel(), bufferSize, logger)
+// bufferDroppedMessageCountMetric reports the messages a sink's truncating
+// buffer dropped under the name of its overflow policy, e.g.
+// bufferDroppedMessageCount.drop-oldest:appId.
+func bufferDroppedMessageCountMetric(policy truncatingbuffer.Policy, appId string, droppedMessageCount *uint64) instrumentation.Metric {
+	return instrumentation.Metric{Name: "bufferDroppedMessageCount." + policy.String() + ":" + appId, Value: atomic.LoadUint64(droppedMessageCount)}
+}
+
+func runTruncatingBuffer(sink Sink, bufferSize uint, policy truncatingbuffer.Policy, droppedMessageCount *uint64, appDroppedMessages *dropcounter.Counter, logger *gosteno.Logger) buffer.MessageBuffer {
+	return runTruncatingBufferFrom(sink.Channel(), bufferSize, policy, droppedMessageCount, appDroppedMessages, logger)
+}
+
+func runTruncatingBufferFrom(input <-chan *logmessage.Message, bufferSize uint, policy truncatingbuffer.Policy, droppedMessageCount *uint64, appDroppedMessages *dropcounter.Counter, logger *gosteno.Logger) buffer.MessageBuffer {
+	b := truncatingbuffer.NewTruncatingBuffer(input, bufferSize, policy, droppedMessageCount, appDroppedMessages, logger)
 	go b.Run()
 	return b
 }
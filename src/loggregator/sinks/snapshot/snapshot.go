@@ -0,0 +1,146 @@
+package snapshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+// A snapshot file starts with the 8 byte magic and a 4 byte version. Every
+// entry follows as a 4 byte CRC-32 of the rest of the entry, an 8 byte
+// timestamp (unix nanoseconds), a 4 byte app id length and a 4 byte data
+// length, all big endian, and then the app id and the data.
+const (
+	magic           = "LGRDUMPS"
+	Version         = 1
+	fileHeaderSize  = 12
+	entryHeaderSize = 20
+
+	// maxEntrySize guards against allocating absurd amounts of memory for
+	// lengths that are corrupt but happen to pass the checksum.
+	maxEntrySize = 16 * 1024 * 1024
+)
+
+var ErrNotASnapshot = errors.New("Not a recent logs snapshot")
+var ErrCorrupt = errors.New("Recent logs snapshot is corrupt")
+
+// Entry is one message of an app.
+type Entry struct {
+	AppId     string
+	Timestamp time.Time
+	Data      []byte
+}
+
+// Write stores entries in the snapshot file at path. It writes a temporary
+// file first, so an existing snapshot is only replaced by a complete one.
+func Write(path string, entries []Entry) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = write(file, entries)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func write(file *os.File, entries []Entry) error {
+	writer := bufio.NewWriter(file)
+
+	header := make([]byte, fileHeaderSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[8:12], Version)
+	if _, err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		record := make([]byte, entryHeaderSize+len(entry.AppId)+len(entry.Data))
+		binary.BigEndian.PutUint64(record[4:12], uint64(entry.Timestamp.UnixNano()))
+		binary.BigEndian.PutUint32(record[12:16], uint32(len(entry.AppId)))
+		binary.BigEndian.PutUint32(record[16:20], uint32(len(entry.Data)))
+		copy(record[entryHeaderSize:], entry.AppId)
+		copy(record[entryHeaderSize+len(entry.AppId):], entry.Data)
+		binary.BigEndian.PutUint32(record[0:4], crc32.ChecksumIEEE(record[4:]))
+
+		if _, err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Read returns the entries of the snapshot file at path in the order they
+// were written and skips those older than maxAge, unless maxAge is 0. If it
+// finds a corrupt entry it returns the entries before it and ErrCorrupt.
+func Read(path string, maxAge time.Duration) (entries []Entry, expired int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, fileHeaderSize)
+	if _, err = io.ReadFull(reader, header); err != nil || string(header[0:8]) != magic {
+		return nil, 0, ErrNotASnapshot
+	}
+	if version := binary.BigEndian.Uint32(header[8:12]); version != Version {
+		return nil, 0, fmt.Errorf("Unsupported recent logs snapshot version: %d", version)
+	}
+
+	entryHeader := make([]byte, entryHeaderSize)
+	for {
+		_, err = io.ReadFull(reader, entryHeader)
+		if err == io.EOF {
+			return entries, expired, nil
+		}
+		if err != nil {
+			return entries, expired, ErrCorrupt
+		}
+
+		appIdLength := binary.BigEndian.Uint32(entryHeader[12:16])
+		dataLength := binary.BigEndian.Uint32(entryHeader[16:20])
+		if appIdLength+dataLength > maxEntrySize {
+			return entries, expired, ErrCorrupt
+		}
+		body := make([]byte, appIdLength+dataLength)
+		if _, err = io.ReadFull(reader, body); err != nil {
+			return entries, expired, ErrCorrupt
+		}
+
+		checksum := crc32.NewIEEE()
+		checksum.Write(entryHeader[4:])
+		checksum.Write(body)
+		if checksum.Sum32() != binary.BigEndian.Uint32(entryHeader[0:4]) {
+			return entries, expired, ErrCorrupt
+		}
+
+		timestamp := time.Unix(0, int64(binary.BigEndian.Uint64(entryHeader[4:12])))
+		if maxAge > 0 && time.Since(timestamp) > maxAge {
+			expired++
+			continue
+		}
+		entries = append(entries, Entry{
+			AppId:     string(body[:appIdLength]),
+			Timestamp: timestamp,
+			Data:      body[appIdLength:],
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package snapshot_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"loggregator/sinks/snapshot"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("Snapshot", func() {
+	var dir string
+	var path string
+	var entries []snapshot.Entry
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "snapshot")
+		Expect(err).ToNot(HaveOccurred())
+		path = filepath.Join(dir, "recent_logs.snapshot")
+
+		now := time.Unix(0, time.Now().UnixNano())
+		entries = []snapshot.Entry{
+			snapshot.Entry{AppId: "app1", Timestamp: now.Add(-time.Minute), Data: []byte("message 1")},
+			snapshot.Entry{AppId: "app2", Timestamp: now, Data: []byte("message 2")},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should read the entries in the order they were written", func() {
+		Expect(snapshot.Write(path, entries)).To(Succeed())
+
+		read, expired, err := snapshot.Read(path, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(expired).To(Equal(0))
+		Expect(read).To(Equal(entries))
+	})
+
+	It("should skip entries older than the maximum age", func() {
+		Expect(snapshot.Write(path, entries)).To(Succeed())
+
+		read, expired, err := snapshot.Read(path, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(expired).To(Equal(1))
+		Expect(read).To(Equal(entries[1:]))
+	})
+
+	It("should return the entries before a corrupt one", func() {
+		Expect(snapshot.Write(path, entries)).To(Succeed())
+
+		data, err := ioutil.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		data[len(data)-1] ^= 0xff
+		Expect(ioutil.WriteFile(path, data, 0600)).To(Succeed())
+
+		read, _, err := snapshot.Read(path, 0)
+		Expect(err).To(Equal(snapshot.ErrCorrupt))
+		Expect(read).To(Equal(entries[:1]))
+	})
+
+	It("should reject files that are not snapshots or of another version", func() {
+		Expect(ioutil.WriteFile(path, []byte("hello"), 0600)).To(Succeed())
+		_, _, err := snapshot.Read(path, 0)
+		Expect(err).To(Equal(snapshot.ErrNotASnapshot))
+
+		Expect(ioutil.WriteFile(path, []byte("LGRDUMPS\x00\x00\x00\x02"), 0600)).To(Succeed())
+		_, _, err = snapshot.Read(path, 0)
+		Expect(err).To(MatchError("Unsupported recent logs snapshot version: 2"))
+	})
+
+	It("should leave an existing snapshot alone when writing fails", func() {
+		Expect(snapshot.Write(path, entries)).To(Succeed())
+		Expect(os.Mkdir(path+".tmp", 0700)).To(Succeed())
+
+		Expect(snapshot.Write(path, entries[:1])).ToNot(Succeed())
+
+		read, _, err := snapshot.Read(path, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read).To(Equal(entries))
+	})
+})
@@ -0,0 +1,293 @@
+package spool
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Every record is stored as an 8 byte timestamp (unix nanoseconds) and a
+// 4 byte payload length, both big endian, followed by the payload.
+const recordHeaderSize = 12
+
+var ErrSpoolFull = errors.New("Spool is full")
+
+type Spool struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+
+	mu   sync.Mutex // guards file and size
+	file *os.File
+	size int64
+}
+
+// New opens (or creates) the spool file for the given drain in dir. Records
+// left over from an earlier run are kept and will be replayed.
+func New(dir, appId, drainUrl string, maxSize int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Spool{
+		path:    filepath.Join(dir, FileName(appId, drainUrl)),
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// FileName derives a stable file name for the spool of a drain.
+func FileName(appId, drainUrl string) string {
+	return fmt.Sprintf("%x.spool", sha1.Sum([]byte(appId+" "+drainUrl)))
+}
+
+func (s *Spool) open() error {
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// Write appends data to the spool. It returns ErrSpoolFull and drops data
+// when the record would take the spool over its size limit.
+func (s *Spool) Write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("Spool is closed")
+	}
+
+	recordSize := int64(recordHeaderSize + len(data))
+	if s.size+recordSize > s.maxSize {
+		return ErrSpoolFull
+	}
+
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint64(record[0:8], uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint32(record[8:12], uint32(len(data)))
+	copy(record[recordHeaderSize:], data)
+
+	n, err := s.file.Write(record)
+	s.size += int64(n)
+	return err
+}
+
+// Size returns the number of bytes currently spooled.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// Replay hands every spooled record to send, oldest first, and skips those
+// older than the maximum age. If send fails the failed record and all the
+// records after it are kept for the next replay. The records are read one
+// at a time, and the spool is only locked while it is opened and rewritten,
+// not while the records are sent.
+func (s *Spool) Replay(send func(data []byte) error) (replayed int, expired int, err error) {
+	reader, end, err := s.openForReplay()
+	if err != nil || reader == nil {
+		return 0, 0, err
+	}
+	defer reader.Close()
+
+	records := newRecordReader(reader, end)
+	for {
+		record, ok := records.next()
+		if !ok {
+			break
+		}
+		if s.maxAge > 0 && time.Since(record.timestamp) > s.maxAge {
+			expired++
+		} else if err = send(record.data); err != nil {
+			if keepErr := s.keepFrom(record.offset); keepErr != nil {
+				return replayed, expired, keepErr
+			}
+			return replayed, expired, err
+		} else {
+			replayed++
+		}
+	}
+
+	return replayed, expired, s.keepFrom(records.offset)
+}
+
+// openForReplay opens the spool file for reading and returns the offset the
+// records written so far end at, or a nil file if there are none.
+func (s *Spool) openForReplay() (*os.File, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil || s.size == 0 {
+		return nil, 0, nil
+	}
+
+	reader, err := os.Open(s.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reader, s.size, nil
+}
+
+type record struct {
+	offset    int64
+	timestamp time.Time
+	data      []byte
+}
+
+// recordReader reads the records of a spool file one at a time.
+type recordReader struct {
+	reader *bufio.Reader
+	header []byte
+	// offset is where the next record starts.
+	offset int64
+}
+
+func newRecordReader(reader io.Reader, end int64) *recordReader {
+	return &recordReader{
+		reader: bufio.NewReader(io.LimitReader(reader, end)),
+		header: make([]byte, recordHeaderSize),
+	}
+}
+
+// next returns the next record, or false at the end of the records.
+func (r *recordReader) next() (record, bool) {
+	_, err := io.ReadFull(r.reader, r.header)
+	if err != nil {
+		// A missing or partial header means we reached the end, possibly
+		// of a record that was only half written before a crash.
+		return record{}, false
+	}
+	timestamp := time.Unix(0, int64(binary.BigEndian.Uint64(r.header[0:8])))
+	data := make([]byte, binary.BigEndian.Uint32(r.header[8:12]))
+	_, err = io.ReadFull(r.reader, data)
+	if err != nil {
+		return record{}, false
+	}
+
+	offset := r.offset
+	r.offset += int64(recordHeaderSize + len(data))
+	return record{offset, timestamp, data}, true
+}
+
+// keepFrom rewrites the spool so that it only holds what follows offset,
+// including records written while it was replayed.
+func (s *Spool) keepFrom(offset int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("Spool is closed")
+	}
+	if offset >= s.size {
+		return s.truncate()
+	}
+
+	reader, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = reader.Seek(offset, os.SEEK_SET)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmpFile, reader)
+	tmpFile.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	s.file.Close()
+	s.file = nil
+	if err = os.Rename(tmpPath, s.path); err != nil {
+		// Keep spooling to the original file, replaying it once more
+		// beats losing the spool.
+		os.Remove(tmpPath)
+		if openErr := s.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	return s.open()
+}
+
+// truncate empties the spool. It must be called with s.mu held.
+func (s *Spool) truncate() error {
+	err := s.file.Truncate(0)
+	if err == nil {
+		s.size = 0
+	}
+	return err
+}
+
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Remove closes the spool and deletes its file.
+func (s *Spool) Remove() error {
+	s.Close()
+	return os.Remove(s.path)
+}
+
+// RemoveExpired deletes the spool files in dir that were not written to for
+// longer than maxAge. Their records are all expired, and they may belong to
+// drains that were unbound while the server was down. It must be called
+// before any spool in dir is opened.
+func RemoveExpired(dir string, maxAge time.Duration) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.spool*"))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) <= maxAge {
+			continue
+		}
+		if err = os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
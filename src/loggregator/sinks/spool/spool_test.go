@@ -0,0 +1,173 @@
+package spool_test
+
+import (
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"loggregator/sinks/spool"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("Spool", func() {
+	var dir string
+	var diskSpool *spool.Spool
+
+	replayAll := func() []string {
+		var replayed []string
+		_, _, err := diskSpool.Replay(func(data []byte) error {
+			replayed = append(replayed, string(data))
+			return nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return replayed
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "spool")
+		Expect(err).ToNot(HaveOccurred())
+
+		diskSpool, err = spool.New(dir, "appId", "syslog://localhost:24632", 1024, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		diskSpool.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should replay messages in the order they were written", func() {
+		Expect(diskSpool.Write([]byte("message 1"))).To(Succeed())
+		Expect(diskSpool.Write([]byte("message 2"))).To(Succeed())
+
+		Expect(replayAll()).To(Equal([]string{"message 1", "message 2"}))
+		Expect(diskSpool.Size()).To(BeZero())
+		Expect(replayAll()).To(BeEmpty())
+	})
+
+	It("should refuse messages once it is full", func() {
+		message := make([]byte, 500)
+		Expect(diskSpool.Write(message)).To(Succeed())
+		Expect(diskSpool.Write(message)).To(Succeed())
+		Expect(diskSpool.Write(message)).To(Equal(spool.ErrSpoolFull))
+
+		Expect(replayAll()).To(HaveLen(2))
+		Expect(diskSpool.Write(message)).To(Succeed())
+	})
+
+	It("should keep the failed message and the ones after it when sending fails", func() {
+		for _, message := range []string{"message 1", "message 2", "message 3"} {
+			Expect(diskSpool.Write([]byte(message))).To(Succeed())
+		}
+
+		replayed, _, err := diskSpool.Replay(func(data []byte) error {
+			if string(data) == "message 2" {
+				return errors.New("drain went away")
+			}
+			return nil
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(replayed).To(Equal(1))
+
+		Expect(diskSpool.Write([]byte("message 4"))).To(Succeed())
+		Expect(replayAll()).To(Equal([]string{"message 2", "message 3", "message 4"}))
+	})
+
+	It("should not be locked while it sends messages", func() {
+		Expect(diskSpool.Write([]byte("message 1"))).To(Succeed())
+		Expect(diskSpool.Write([]byte("message 2"))).To(Succeed())
+
+		var sizes []int64
+		_, _, err := diskSpool.Replay(func(data []byte) error {
+			sizes = append(sizes, diskSpool.Size())
+			return nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sizes).To(HaveLen(2))
+	})
+
+	It("should keep messages written while it replays", func() {
+		Expect(diskSpool.Write([]byte("message 1"))).To(Succeed())
+
+		_, _, err := diskSpool.Replay(func(data []byte) error {
+			return diskSpool.Write([]byte("message 2"))
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(replayAll()).To(Equal([]string{"message 2"}))
+	})
+
+	It("should skip messages older than the maximum age", func() {
+		diskSpool.Close()
+		var err error
+		diskSpool, err = spool.New(dir, "appId", "syslog://localhost:24632", 1024, time.Millisecond)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(diskSpool.Write([]byte("message 1"))).To(Succeed())
+		time.Sleep(5 * time.Millisecond)
+
+		replayed, expired, err := diskSpool.Replay(func(data []byte) error { return nil })
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replayed).To(Equal(0))
+		Expect(expired).To(Equal(1))
+	})
+
+	It("should pick up messages spooled before it was reopened", func() {
+		Expect(diskSpool.Write([]byte("message 1"))).To(Succeed())
+		diskSpool.Close()
+
+		var err error
+		diskSpool, err = spool.New(dir, "appId", "syslog://localhost:24632", 1024, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(replayAll()).To(Equal([]string{"message 1"}))
+	})
+
+	It("should delete its file when removed", func() {
+		Expect(diskSpool.Write([]byte("message 1"))).To(Succeed())
+		Expect(diskSpool.Remove()).To(Succeed())
+
+		_, err := os.Stat(filepath.Join(dir, spool.FileName("appId", "syslog://localhost:24632")))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should replay the records before one that was only half written", func() {
+		Expect(diskSpool.Write([]byte("message 1"))).To(Succeed())
+		diskSpool.Close()
+
+		path := filepath.Join(dir, spool.FileName("appId", "syslog://localhost:24632"))
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = file.Write([]byte{0, 0, 0})
+		Expect(err).ToNot(HaveOccurred())
+		file.Close()
+
+		diskSpool, err = spool.New(dir, "appId", "syslog://localhost:24632", 1024, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replayAll()).To(Equal([]string{"message 1"}))
+	})
+
+	Describe("RemoveExpired", func() {
+		It("should delete the spool files not written to for longer than the maximum age", func() {
+			Expect(diskSpool.Write([]byte("message 1"))).To(Succeed())
+			diskSpool.Close()
+
+			orphan := filepath.Join(dir, spool.FileName("appId", "syslog://unbound:24632"))
+			Expect(ioutil.WriteFile(orphan, []byte("stale"), 0600)).To(Succeed())
+			longAgo := time.Now().Add(-2 * time.Hour)
+			Expect(os.Chtimes(orphan, longAgo, longAgo)).To(Succeed())
+
+			removed, err := spool.RemoveExpired(dir, time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(removed).To(Equal(1))
+
+			_, err = os.Stat(orphan)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			_, err = os.Stat(filepath.Join(dir, spool.FileName("appId", "syslog://localhost:24632")))
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+})
@@ -5,109 +5,523 @@ import (
 	"github.com/cloudfoundry/gosteno"
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"loggregator/buffer"
+	"loggregator/buffer/truncatingbuffer"
+	"loggregator/dropcounter"
+	"loggregator/sinks/circuitbreaker"
+	"loggregator/sinks/ratelimiter"
 	"loggregator/sinks/retrystrategy"
+	"loggregator/sinks/spool"
 	"loggregator/sinks/syslogwriter"
+	"multiline"
+	"net/url"
+	"strconv"
 	"sync/atomic"
 	"time"
 )
 
+// Drops due to rate limits are summarized to the app about this often.
+const rateLimitNoticeInterval = 30 * time.Second
+
 type SyslogSink struct {
-	logger            *gosteno.Logger
-	appId             string
-	drainUrl          string
-	sentMessageCount  *uint64
-	sentByteCount     *uint64
-	listenerChannel   chan *logmessage.Message
-	syslogWriter      syslogwriter.SyslogWriter
-	errorChannel      chan<- *logmessage.Message
-	disconnectChannel chan int
-}
-
-func NewSyslogSink(appId string, drainUrl string, givenLogger *gosteno.Logger, syslogWriter syslogwriter.SyslogWriter, errorChannel chan<- *logmessage.Message) Sink {
+	logger                    *gosteno.Logger
+	appId                     string
+	drainUrl                  string
+	sentMessageCount          *uint64
+	sentByteCount             *uint64
+	droppedMessageCount       *uint64
+	filteredMessageCount      *uint64
+	rateLimitedMessageCount   *uint64
+	spooledMessageCount       *uint64
+	spoolDroppedMessageCount  *uint64
+	bufferDroppedMessageCount *uint64
+	listenerChannel           chan *logmessage.Message
+	syslogWriter              syslogwriter.SyslogWriter
+	backoffStrategy           retrystrategy.RetryStrategy
+	errorChannel              chan<- *logmessage.Message
+	disconnectChannel         chan int
+	spool                     *spool.Spool
+	spoolOverflowCount        int
+	spoolDiscarded            *uint32
+	circuitBreaker            *circuitbreaker.CircuitBreaker
+	filter                    *MessageFilter
+	rateLimiter               *ratelimiter.Limiter
+	multilineConfig           *multiline.Config
+	overflowPolicy            truncatingbuffer.Policy
+	appDroppedMessages        *dropcounter.Counter
+	rateLimitDrops            int
+	lastRateLimitNotice       time.Time
+	rateLimitNoticeInterval   time.Duration
+	health                    drainHealth
+}
+
+// SyslogSinkOptions holds the optional parts of a SyslogSink. The zero value
+// leaves all of them out.
+type SyslogSinkOptions struct {
+	// Messages arriving while the drain is unreachable are kept in Spool
+	// and replayed once a connection could be made.
+	Spool *spool.Spool
+	// A drain that keeps failing is only probed every now and then.
+	CircuitBreaker *circuitbreaker.CircuitBreaker
+	// Failed attempts are retried as told by BackoffStrategy, with an
+	// exponential back-off if it is nil.
+	BackoffStrategy retrystrategy.RetryStrategy
+	// Messages Filter does not allow are skipped.
+	Filter *MessageFilter
+	// Messages over the limits of RateLimiter are dropped.
+	RateLimiter *ratelimiter.Limiter
+	// Lines are coalesced into multi-line messages before they are sent.
+	Multiline *multiline.Config
+	// Messages that pile up while the drain is slow are dropped as told by
+	// OverflowPolicy.
+	OverflowPolicy truncatingbuffer.Policy
+	// Dropped messages are counted per app in AppDroppedMessages.
+	AppDroppedMessages *dropcounter.Counter
+}
+
+// NewSyslogSink creates a drain writing to syslogWriter.
+func NewSyslogSink(appId string, drainUrl string, givenLogger *gosteno.Logger, syslogWriter syslogwriter.SyslogWriter, errorChannel chan<- *logmessage.Message, options SyslogSinkOptions) Drain {
 	givenLogger.Debugf("Syslog Sink %s: Created for appId [%s]", drainUrl, appId)
+
+	backoffStrategy := options.BackoffStrategy
+	if backoffStrategy == nil {
+		backoffStrategy = retrystrategy.NewExponentialRetryStrategy()
+	}
+
 	return &SyslogSink{
-		appId:             appId,
-		drainUrl:          drainUrl,
-		logger:            givenLogger,
-		sentMessageCount:  new(uint64),
-		sentByteCount:     new(uint64),
-		listenerChannel:   make(chan *logmessage.Message),
-		syslogWriter:      syslogWriter,
-		errorChannel:      errorChannel,
-		disconnectChannel: make(chan int),
+		appId:                     appId,
+		drainUrl:                  drainUrl,
+		logger:                    givenLogger,
+		sentMessageCount:          new(uint64),
+		sentByteCount:             new(uint64),
+		droppedMessageCount:       new(uint64),
+		filteredMessageCount:      new(uint64),
+		rateLimitedMessageCount:   new(uint64),
+		spooledMessageCount:       new(uint64),
+		spoolDroppedMessageCount:  new(uint64),
+		bufferDroppedMessageCount: new(uint64),
+		listenerChannel:           make(chan *logmessage.Message),
+		syslogWriter:              syslogWriter,
+		backoffStrategy:           backoffStrategy,
+		errorChannel:              errorChannel,
+		disconnectChannel:         make(chan int),
+		spoolDiscarded:            new(uint32),
+		spool:                     options.Spool,
+		circuitBreaker:            options.CircuitBreaker,
+		filter:                    options.Filter,
+		rateLimiter:               options.RateLimiter,
+		multilineConfig:           options.Multiline,
+		overflowPolicy:            options.OverflowPolicy,
+		appDroppedMessages:        options.AppDroppedMessages,
+		rateLimitNoticeInterval:   rateLimitNoticeInterval,
+	}
+}
+
+func newSyslogDrain(appId string, drainUrl string, parsedUrl *url.URL, config DrainConfig, logger *gosteno.Logger, errorChannel chan<- *logmessage.Message) (Drain, error) {
+	backoffStrategy, err := newRetryStrategy(parsedUrl, config)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := NewMessageFilter(parsedUrl.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimiter, err := newRateLimiter(parsedUrl, config)
+	if err != nil {
+		return nil, err
+	}
+
+	multilineConfig, err := newMultilineConfig(parsedUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	overflowPolicy, err := newOverflowPolicy(parsedUrl, config.SyslogOverflowPolicy, config)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, err := syslogwriter.NewResolver(parsedUrl.Host, config.DNSTTL, config.BlacklistIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := newSyslogHeader(parsedUrl, config)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme, format := syslogTransport(parsedUrl)
+	formatter, err := syslogwriter.NewFormatter(format, parsedUrl.Query().Get("framing"), scheme, header)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := newTLSConfig(appId, parsedUrl, config)
+	if err != nil {
+		return nil, err
+	}
+
+	syslogWriter := syslogwriter.NewSyslogWriter(scheme, parsedUrl.Host, appId, tlsConfig, config.WriteTimeout, resolver, formatter)
+
+	var diskSpool *spool.Spool
+	if config.SpoolDirectory != "" {
+		diskSpool, err = spool.New(config.SpoolDirectory, appId, drainUrl, config.SpoolMaxSize, config.SpoolMaxAge)
+		if err != nil {
+			logger.Warnf("Syslog Sink %s: Could not create spool. Running without it. Err: %v", drainUrl, err)
+		}
+	}
+
+	var circuitBreaker *circuitbreaker.CircuitBreaker
+	if config.CircuitBreakerMaxFailures > 0 || config.CircuitBreakerMaxFailureDuration > 0 {
+		circuitBreaker = circuitbreaker.New(config.CircuitBreakerMaxFailures, config.CircuitBreakerMaxFailureDuration, config.CircuitBreakerProbeInterval)
+	}
+
+	return NewSyslogSink(appId, drainUrl, logger, syslogWriter, errorChannel, SyslogSinkOptions{
+		Spool:              diskSpool,
+		CircuitBreaker:     circuitBreaker,
+		BackoffStrategy:    backoffStrategy,
+		Filter:             filter,
+		RateLimiter:        rateLimiter,
+		Multiline:          multilineConfig,
+		OverflowPolicy:     overflowPolicy,
+		AppDroppedMessages: config.AppDroppedMessages,
+	}), nil
+}
+
+// syslogTransport returns the syslog scheme to connect with and the format
+// to write in for a drain URL. The json+tcp and json+tls schemes are
+// shorthands for syslog and syslog-tls with format=json, gelf+tcp for
+// syslog with format=gelf. GELF over UDP is sent by a writer of its own.
+func syslogTransport(parsedUrl *url.URL) (scheme string, format string) {
+	format = parsedUrl.Query().Get("format")
+	switch parsedUrl.Scheme {
+	case "json+tcp":
+		return "syslog", syslogwriter.FormatJSON
+	case "json+tls":
+		return "syslog-tls", syslogwriter.FormatJSON
+	case "gelf+tcp":
+		return "syslog", syslogwriter.FormatGELF
+	case "gelf", "gelf+udp":
+		return "gelf+udp", ""
+	}
+	if parsedUrl.Scheme == "syslog-udp" && format == syslogwriter.FormatGELF {
+		return "gelf+udp", ""
+	}
+	return parsedUrl.Scheme, format
+}
+
+// newSyslogHeader returns the RFC5424 header fields of a drain, which its
+// URL may override with the hostname, facility, appname and
+// structured_data query parameters.
+func newSyslogHeader(parsedUrl *url.URL, config DrainConfig) (syslogwriter.Header, error) {
+	query := parsedUrl.Query()
+	header := config.SyslogHeader
+
+	if value := query.Get("hostname"); value != "" {
+		header.Hostname = value
+	}
+	if value := query.Get("appname"); value != "" {
+		header.AppName = value
 	}
+	if value := query.Get("facility"); value != "" {
+		facility, err := syslogwriter.ParseFacility(value)
+		if err != nil {
+			return header, err
+		}
+		header.Facility = facility
+	}
+	if value := query.Get("structured_data"); value != "" {
+		structuredData, err := strconv.ParseBool(value)
+		if err != nil {
+			return header, fmt.Errorf("Invalid structured_data: %s", value)
+		}
+		header.StructuredData = structuredData
+	}
+
+	return header, nil
 }
 
 func (s *SyslogSink) Run() {
 	s.logger.Infof("Syslog Sink %s: Running.", s.drainUrl)
 	defer s.logger.Errorf("Syslog Sink %s: Stopped. This should never happen", s.drainUrl)
 
-	backoffStrategy := retrystrategy.NewExponentialRetryStrategy()
+	// The spool file outlives the sink, so messages spooled during an outage
+	// are replayed by the next sink for the drain, e.g. after a restart.
+	if s.spool != nil {
+		defer func() {
+			if atomic.LoadUint32(s.spoolDiscarded) == 1 {
+				s.spool.Remove()
+			} else {
+				s.spool.Close()
+			}
+		}()
+	}
+
 	numberOfTries := 0
+	currentBackoff := time.Duration(0)
+
+	input := (<-chan *logmessage.Message)(s.listenerChannel)
+	if s.multilineConfig != nil {
+		input = coalesce(input, *s.multilineConfig, s.logger)
+	}
+	buffer := runTruncatingBufferFrom(input, 100, s.overflowPolicy, s.bufferDroppedMessageCount, s.appDroppedMessages, s.Logger())
+
+	// Drops are also reported when no further messages arrive.
+	var rateLimitNotices <-chan time.Time
+	if s.rateLimiter != nil {
+		ticker := time.NewTicker(s.rateLimitNoticeInterval)
+		defer ticker.Stop()
+		rateLimitNotices = ticker.C
+	}
 
-	buffer := runTruncatingBuffer(s, 100, s.Logger())
 	for {
-		s.logger.Debugf("Syslog Sink %s: Starting loop. Current backoff: %v", s.drainUrl, backoffStrategy(numberOfTries))
+		s.logger.Debugf("Syslog Sink %s: Starting loop. Current backoff: %v", s.drainUrl, currentBackoff)
 
-		select {
-		case <-s.disconnectChannel:
-			return
-		case <-time.After(backoffStrategy(numberOfTries)):
+		backoff := time.After(currentBackoff)
+	backingOff:
+		for {
+			select {
+			case <-s.disconnectChannel:
+				return
+			case <-backoff:
+				break backingOff
+			case message, ok := <-s.spoolingChannel(buffer):
+				if !ok {
+					s.logger.Debugf("Syslog Sink %s: Closed listener channel detected. Closing.\n", s.drainUrl)
+					return
+				}
+				if s.allows(message) {
+					s.spoolMessage(message)
+				}
+			case <-rateLimitNotices:
+				s.reportRateLimitDrops()
+			}
 		}
 
 		if !s.syslogWriter.IsConnected() {
 			s.logger.Debugf("Syslog Sink %s: Not connected. Trying to connect.", s.drainUrl)
+			if s.circuitBreaker != nil {
+				s.circuitBreaker.Probe()
+			}
 			err := s.syslogWriter.Connect()
 			if err != nil {
-				errorMsg := fmt.Sprintf("Syslog Sink %s: Error when dialing out. Backing off for %v. Err: %v", s.drainUrl, backoffStrategy(numberOfTries+1), err)
 				numberOfTries++
-
-				s.logger.Warnf(errorMsg)
-				logMessage, err := logmessage.GenerateMessage(logmessage.LogMessage_ERR, errorMsg, s.appId, "LGR")
-				if err == nil {
-					s.errorChannel <- logMessage
-				} else {
-					s.logger.Warnf("Error marshalling message: %v", err)
+				var opened bool
+				currentBackoff, opened = s.recordFailure(err, numberOfTries)
+				switch {
+				case opened:
+					s.sendCircuitOpenedError(err)
+				case s.circuitBreaker != nil && s.circuitBreaker.IsOpen():
+					s.logger.Debugf("Syslog Sink %s: Probe failed. Probing again in %v. Err: %v", s.drainUrl, s.circuitBreaker.ProbeInterval(), err)
+				default:
+					s.sendError(fmt.Sprintf("Syslog Sink %s: Error when dialing out. Backing off for %v. Err: %v", s.drainUrl, currentBackoff, err))
 				}
 				continue
 			}
 			s.logger.Infof("Syslog Sink %s: successfully connected.", s.drainUrl)
 			s.syslogWriter.SetConnected(true)
+			s.recordSuccess()
 			numberOfTries = 0
+			currentBackoff = 0
 			defer s.syslogWriter.Close()
+
+			err = s.replaySpool()
+			if err != nil {
+				s.logger.Debugf("Syslog Sink %s: Error when replaying spooled messages. Backing off. Err: %v\n", s.drainUrl, err)
+				numberOfTries++
+				var opened bool
+				if currentBackoff, opened = s.recordFailure(err, numberOfTries); opened {
+					s.sendCircuitOpenedError(err)
+				}
+				s.syslogWriter.SetConnected(false)
+				continue
+			}
 		}
 
 		s.logger.Debugf("Syslog Sink %s: Waiting for activity\n", s.drainUrl)
 
-		message, ok := <-buffer.GetOutputChannel()
+		var message *logmessage.Message
+		var ok bool
+		select {
+		case message, ok = <-buffer.GetOutputChannel():
+		case <-rateLimitNotices:
+			s.reportRateLimitDrops()
+			continue
+		}
 		if !ok {
 			s.logger.Debugf("Syslog Sink %s: Closed listener channel detected. Closing.\n", s.drainUrl)
 			return
 		}
 
-		s.logger.Debugf("Syslog Sink %s: Got %d bytes. Sending data\n", s.drainUrl, message.GetRawMessageLength())
+		if !s.allows(message) {
+			continue
+		}
 
-		var err error
+		s.logger.Debugf("Syslog Sink %s: Got %d bytes. Sending data\n", s.drainUrl, message.GetRawMessageLength())
 
-		switch message.GetLogMessage().GetMessageType() {
-		case logmessage.LogMessage_OUT:
-			_, err = s.syslogWriter.WriteStdout(message.GetLogMessage().GetMessage(), message.GetLogMessage().GetSourceName(), message.GetLogMessage().GetSourceId(), *message.GetLogMessage().Timestamp)
-		case logmessage.LogMessage_ERR:
-			_, err = s.syslogWriter.WriteStderr(message.GetLogMessage().GetMessage(), message.GetLogMessage().GetSourceName(), message.GetLogMessage().GetSourceId(), *message.GetLogMessage().Timestamp)
-		}
+		err := s.write(message)
 		if err != nil {
 			s.logger.Debugf("Syslog Sink %s: Error when trying to send data to sink. Backing off. Err: %v\n", s.drainUrl, err)
 			numberOfTries++
+			var opened bool
+			if currentBackoff, opened = s.recordFailure(err, numberOfTries); opened {
+				s.sendCircuitOpenedError(err)
+			}
 			s.syslogWriter.SetConnected(false)
+			if s.spool != nil {
+				s.spoolMessage(message)
+			} else {
+				atomic.AddUint64(s.droppedMessageCount, 1)
+			}
 		} else {
 			s.logger.Debugf("Syslog Sink %s: Successfully sent data\n", s.drainUrl)
+			s.recordSuccess()
 			numberOfTries = 0
-			atomic.AddUint64(s.sentMessageCount, 1)
-			atomic.AddUint64(s.sentByteCount, uint64(message.GetRawMessageLength()))
+			currentBackoff = 0
 		}
 	}
 }
 
+// backoff returns how long to wait before the next attempt. Drains with an
+// open circuit are only probed every probe interval.
+func (s *SyslogSink) backoff(numberOfTries int) time.Duration {
+	if s.circuitBreaker != nil && s.circuitBreaker.IsOpen() {
+		return s.circuitBreaker.ProbeInterval()
+	}
+	return s.backoffStrategy(numberOfTries)
+}
+
+// recordFailure returns how long to back off after the failure and whether
+// it opened the circuit. It asks the retry strategy once per attempt, as
+// some strategies keep state.
+func (s *SyslogSink) recordFailure(err error, numberOfTries int) (time.Duration, bool) {
+	opened := s.circuitBreaker != nil && s.circuitBreaker.Failure()
+	backoff := s.backoff(numberOfTries)
+	s.health.failed(err, backoff)
+	return backoff, opened
+}
+
+func (s *SyslogSink) recordSuccess() {
+	s.health.succeeded()
+	if s.circuitBreaker != nil && s.circuitBreaker.Success() {
+		s.logger.Infof("Syslog Sink %s: Drain is reachable again. Closed circuit.", s.drainUrl)
+	}
+}
+
+func (s *SyslogSink) sendCircuitOpenedError(err error) {
+	s.sendError(fmt.Sprintf("Syslog Sink %s: Giving up after %d failed attempts over %v. Will only retry every %v until the drain is reachable. Err: %v",
+		s.drainUrl, s.circuitBreaker.Failures(), s.circuitBreaker.FailingFor(), s.circuitBreaker.ProbeInterval(), err))
+}
+
+// allows applies the filter and the rate limits of the drain and counts the
+// messages they hold back.
+func (s *SyslogSink) allows(message *logmessage.Message) bool {
+	if !s.filter.Allows(message.GetLogMessage()) {
+		atomic.AddUint64(s.filteredMessageCount, 1)
+		return false
+	}
+
+	allowed := s.rateLimiter.Allow(len(message.GetLogMessage().GetMessage()))
+	if !allowed {
+		atomic.AddUint64(s.rateLimitedMessageCount, 1)
+		s.rateLimitDrops++
+	}
+	if time.Since(s.lastRateLimitNotice) >= s.rateLimitNoticeInterval {
+		s.reportRateLimitDrops()
+	}
+	return allowed
+}
+
+// reportRateLimitDrops tells the app how many messages the rate limits
+// dropped since it was last told.
+func (s *SyslogSink) reportRateLimitDrops() {
+	if s.rateLimitDrops == 0 {
+		return
+	}
+	s.sendError(fmt.Sprintf("Syslog Sink %s: Dropped %d messages due to drain rate limit", s.drainUrl, s.rateLimitDrops))
+	s.rateLimitDrops = 0
+	s.lastRateLimitNotice = time.Now()
+}
+
+func (s *SyslogSink) write(message *logmessage.Message) error {
+	var err error
+
+	switch message.GetLogMessage().GetMessageType() {
+	case logmessage.LogMessage_OUT:
+		_, err = s.syslogWriter.WriteStdout(message.GetLogMessage().GetMessage(), message.GetLogMessage().GetSourceName(), message.GetLogMessage().GetSourceId(), *message.GetLogMessage().Timestamp)
+	case logmessage.LogMessage_ERR:
+		_, err = s.syslogWriter.WriteStderr(message.GetLogMessage().GetMessage(), message.GetLogMessage().GetSourceName(), message.GetLogMessage().GetSourceId(), *message.GetLogMessage().Timestamp)
+	}
+	if err == nil {
+		atomic.AddUint64(s.sentMessageCount, 1)
+		atomic.AddUint64(s.sentByteCount, uint64(message.GetRawMessageLength()))
+	}
+	return err
+}
+
+// spoolingChannel returns the channel to move messages into the spool from
+// while the drain is unreachable. Receiving from the nil channel it returns
+// otherwise blocks forever.
+func (s *SyslogSink) spoolingChannel(messageBuffer buffer.MessageBuffer) <-chan *logmessage.Message {
+	if s.spool == nil || s.syslogWriter.IsConnected() {
+		return nil
+	}
+	return messageBuffer.GetOutputChannel()
+}
+
+func (s *SyslogSink) spoolMessage(message *logmessage.Message) {
+	err := s.spool.Write(message.GetRawMessage())
+	if err == nil {
+		atomic.AddUint64(s.spooledMessageCount, 1)
+		return
+	}
+
+	atomic.AddUint64(s.spoolDroppedMessageCount, 1)
+	s.spoolOverflowCount++
+	if s.spoolOverflowCount == 1 {
+		s.sendError(fmt.Sprintf("Syslog Sink %s: Spool is full. Dropping messages until the drain is reachable again. Err: %v", s.drainUrl, err))
+	}
+}
+
+func (s *SyslogSink) replaySpool() error {
+	if s.spool == nil {
+		return nil
+	}
+
+	replayed, expired, err := s.spool.Replay(func(data []byte) error {
+		message, err := logmessage.ParseMessage(data)
+		if err != nil {
+			s.logger.Warnf("Syslog Sink %s: Dropping spooled message that could not be parsed. Err: %v", s.drainUrl, err)
+			return nil
+		}
+		return s.write(message)
+	})
+	s.logger.Debugf("Syslog Sink %s: Replayed %d spooled messages\n", s.drainUrl, replayed)
+	if err != nil {
+		return err
+	}
+
+	atomic.AddUint64(s.spoolDroppedMessageCount, uint64(expired))
+	if s.spoolOverflowCount > 0 || expired > 0 {
+		s.sendError(fmt.Sprintf("Syslog Sink %s: Dropped %d messages because the spool was full and %d because they were too old while the drain was unreachable.", s.drainUrl, s.spoolOverflowCount, expired))
+		s.spoolOverflowCount = 0
+	}
+	return nil
+}
+
+func (s *SyslogSink) sendError(errorMsg string) {
+	s.logger.Warnf(errorMsg)
+	logMessage, err := logmessage.GenerateMessage(logmessage.LogMessage_ERR, errorMsg, s.appId, "LGR")
+	if err == nil {
+		s.errorChannel <- logMessage
+	} else {
+		s.logger.Warnf("Error marshalling message: %v", err)
+	}
+}
+
 func (s *SyslogSink) Channel() chan *logmessage.Message {
 	return s.listenerChannel
 }
@@ -118,6 +532,29 @@ func (s *SyslogSink) Disconnect() {
 	}
 }
 
+// DiscardSpool makes the sink delete its spool when it stops, as the drain
+// was removed for good.
+func (s *SyslogSink) DiscardSpool() {
+	atomic.StoreUint32(s.spoolDiscarded, 1)
+}
+
+func (s *SyslogSink) DrainType() string {
+	return "syslog"
+}
+
+func (s *SyslogSink) IsConnected() bool {
+	return s.syslogWriter.IsConnected()
+}
+
+func (s *SyslogSink) Status() DrainStatus {
+	dropped := atomic.LoadUint64(s.droppedMessageCount) + atomic.LoadUint64(s.spoolDroppedMessageCount) + atomic.LoadUint64(s.rateLimitedMessageCount) + atomic.LoadUint64(s.bufferDroppedMessageCount)
+	status := s.health.status(s, atomic.LoadUint64(s.sentMessageCount), dropped)
+	if s.circuitBreaker != nil {
+		status.CircuitState = s.circuitBreaker.State().String()
+	}
+	return status
+}
+
 func (s *SyslogSink) Logger() *gosteno.Logger {
 	return s.logger
 }
@@ -135,10 +572,36 @@ func (s *SyslogSink) ShouldReceiveErrors() bool {
 }
 
 func (s *SyslogSink) Emit() instrumentation.Context {
+	metrics := []instrumentation.Metric{
+		instrumentation.Metric{Name: "sentMessageCount:" + s.appId, Value: atomic.LoadUint64(s.sentMessageCount)},
+		instrumentation.Metric{Name: "sentByteCount:" + s.appId, Value: atomic.LoadUint64(s.sentByteCount)},
+		instrumentation.Metric{Name: "droppedMessageCount:" + s.appId, Value: atomic.LoadUint64(s.droppedMessageCount)},
+		bufferDroppedMessageCountMetric(s.overflowPolicy, s.appId, s.bufferDroppedMessageCount),
+	}
+	if s.spool != nil {
+		metrics = append(metrics,
+			instrumentation.Metric{Name: "spooledMessageCount:" + s.appId, Value: atomic.LoadUint64(s.spooledMessageCount)},
+			instrumentation.Metric{Name: "spoolDroppedMessageCount:" + s.appId, Value: atomic.LoadUint64(s.spoolDroppedMessageCount)},
+			instrumentation.Metric{Name: "spoolSize:" + s.appId, Value: s.spool.Size()},
+		)
+	}
+	if s.filter != nil {
+		metrics = append(metrics, instrumentation.Metric{Name: "filteredMessageCount:" + s.appId, Value: atomic.LoadUint64(s.filteredMessageCount)})
+	}
+	if s.rateLimiter != nil {
+		metrics = append(metrics, instrumentation.Metric{Name: "rateLimitedMessageCount:" + s.appId, Value: atomic.LoadUint64(s.rateLimitedMessageCount)})
+	}
+	if s.circuitBreaker != nil {
+		metrics = append(metrics,
+			instrumentation.Metric{Name: "circuitState:" + s.appId, Value: int(s.circuitBreaker.State())},
+			instrumentation.Metric{Name: "circuitOpenCount:" + s.appId, Value: s.circuitBreaker.OpenCount()},
+		)
+	}
+	if instrumentable, ok := s.syslogWriter.(instrumentation.Instrumentable); ok {
+		metrics = append(metrics, instrumentable.Emit().Metrics...)
+	}
+
 	return instrumentation.Context{Name: "syslogSink",
-		Metrics: []instrumentation.Metric{
-			instrumentation.Metric{Name: "sentMessageCount:" + s.appId, Value: atomic.LoadUint64(s.sentMessageCount)},
-			instrumentation.Metric{Name: "sentByteCount:" + s.appId, Value: atomic.LoadUint64(s.sentByteCount)},
-		},
+		Metrics: metrics,
 	}
 }
@@ -0,0 +1,48 @@
+package sinks
+
+import (
+	"github.com/cloudfoundry/loggregatorlib/loggertesthelper"
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	messagetesthelpers "github.com/cloudfoundry/loggregatorlib/logmessage/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"loggregator/sinks/ratelimiter"
+	"testing"
+	"time"
+)
+
+type discardingSyslogWriter struct{}
+
+func (w discardingSyslogWriter) Connect() error { return nil }
+func (w discardingSyslogWriter) WriteStdout(b []byte, source, sourceId string, timestamp int64) (int, error) {
+	return len(b), nil
+}
+func (w discardingSyslogWriter) WriteStderr(b []byte, source, sourceId string, timestamp int64) (int, error) {
+	return len(b), nil
+}
+func (w discardingSyslogWriter) Close() error      { return nil }
+func (w discardingSyslogWriter) IsConnected() bool { return true }
+func (w discardingSyslogWriter) SetConnected(bool) {}
+
+func TestRateLimitDropsAreReportedWithoutFurtherMessages(t *testing.T) {
+	errorChannel := make(chan *logmessage.Message, 10)
+	sink := NewSyslogSink("appId", "syslog://localhost:24632", loggertesthelper.Logger(), discardingSyslogWriter{}, errorChannel, SyslogSinkOptions{RateLimiter: ratelimiter.New(1, 0, nil)}).(*SyslogSink)
+	sink.rateLimitNoticeInterval = 50 * time.Millisecond
+	go sink.Run()
+	defer close(sink.Channel())
+
+	for i := 0; i < 3; i++ {
+		sink.Channel() <- messagetesthelpers.NewMessage(t, "message", "appId")
+	}
+
+	reported := ""
+	for i := 0; i < 2; i++ {
+		select {
+		case errorMessage := <-errorChannel:
+			reported += string(errorMessage.GetLogMessage().GetMessage()) + "\n"
+		case <-time.After(time.Second):
+			t.Fatalf("Expected two drop notices, got: %s", reported)
+		}
+	}
+	assert.Equal(t, reported, "Syslog Sink syslog://localhost:24632: Dropped 1 messages due to drain rate limit\n"+
+		"Syslog Sink syslog://localhost:24632: Dropped 1 messages due to drain rate limit\n")
+}
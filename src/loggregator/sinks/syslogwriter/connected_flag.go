@@ -0,0 +1,23 @@
+package syslogwriter
+
+import (
+	"sync/atomic"
+)
+
+// connectedFlag holds whether a writer is connected. Sinks set it while
+// the drain status endpoint and varz read it, so it is accessed atomically.
+type connectedFlag struct {
+	connected int32
+}
+
+func (f *connectedFlag) IsConnected() bool {
+	return atomic.LoadInt32(&f.connected) == 1
+}
+
+func (f *connectedFlag) SetConnected(newValue bool) {
+	var connected int32
+	if newValue {
+		connected = 1
+	}
+	atomic.StoreInt32(&f.connected, connected)
+}
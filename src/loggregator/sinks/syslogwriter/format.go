@@ -0,0 +1,114 @@
+package syslogwriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	FormatRFC5424 = "rfc5424"
+	FormatRFC3164 = "rfc3164"
+	FormatJSON    = "json"
+)
+
+// Framings of syslog messages on stream transports as described in
+// https://tools.ietf.org/html/rfc6587#section-3.4
+const (
+	FramingOctetCounting  = "octet-counting"
+	FramingNonTransparent = "non-transparent"
+)
+
+// Formatter renders a message into the bytes written to a drain, including
+// any framing.
+type Formatter func(p int, appId, source, sourceId, msg string, timestamp int64) string
+
+// NewFormatter returns the Formatter for the named format and framing on
+// the transport of scheme. Syslog messages are rendered with the fields of
+// header and framed on stream transports only, with octet counting for
+// RFC5424 and newlines for RFC3164 unless told otherwise. The JSON and GELF
+// formats bring their own framing.
+func NewFormatter(format string, framing string, scheme string, header Header) (Formatter, error) {
+	var message Formatter
+	switch format {
+	case "", FormatRFC5424:
+		message = header.Message
+		if framing == "" {
+			framing = FramingOctetCounting
+		}
+	case FormatRFC3164:
+		message = header.RFC3164Message
+		if framing == "" {
+			framing = FramingNonTransparent
+		}
+	case FormatJSON:
+		return FormatJsonLine, nil
+	case FormatGELF:
+		return FormatGelfFrame, nil
+	default:
+		return nil, fmt.Errorf("Unknown drain format: %s", format)
+	}
+
+	var framed Formatter
+	switch framing {
+	case FramingOctetCounting:
+		framed = octetCounted(message)
+	case FramingNonTransparent:
+		framed = nonTransparent(message)
+	default:
+		return nil, fmt.Errorf("Unknown drain framing: %s", framing)
+	}
+
+	if scheme == "syslog-udp" || scheme == "relp" {
+		return message, nil
+	}
+	return framed, nil
+}
+
+// octetCounted frames the messages of format with octet counting:
+// https://tools.ietf.org/html/rfc6587#section-3.4.1
+func octetCounted(format Formatter) Formatter {
+	return func(p int, appId, source, sourceId, msg string, timestamp int64) string {
+		syslogMsg := format(p, appId, source, sourceId, msg, timestamp)
+		return fmt.Sprintf("%d %s", len(syslogMsg), syslogMsg)
+	}
+}
+
+// nonTransparent frames the messages of format with a trailing newline:
+// https://tools.ietf.org/html/rfc6587#section-3.4.2
+// Newlines within messages are escaped as \n, so a receiver does not take
+// them for the end of the message. Backslashes are escaped as \\, so a
+// literal \n in a message can be told apart from an escaped newline.
+func nonTransparent(format Formatter) Formatter {
+	return func(p int, appId, source, sourceId, msg string, timestamp int64) string {
+		syslogMsg := strings.TrimSuffix(format(p, appId, source, sourceId, msg, timestamp), "\n")
+		return nonTransparentEscaper.Replace(syslogMsg) + "\n"
+	}
+}
+
+var nonTransparentEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+type jsonLine struct {
+	AppId       string `json:"app_id"`
+	SourceName  string `json:"source_name"`
+	SourceId    string `json:"source_id"`
+	MessageType string `json:"message_type"`
+	Timestamp   string `json:"timestamp"`
+	Message     string `json:"message"`
+}
+
+// FormatJsonLine renders a message as a JSON object on a line of its own,
+// as expected by Logstash's json_lines codec.
+func FormatJsonLine(p int, appId, source, sourceId, msg string, timestamp int64) string {
+	// A struct of strings always marshals.
+	line, _ := json.Marshal(jsonLine{
+		AppId:       appId,
+		SourceName:  source,
+		SourceId:    sourceId,
+		MessageType: messageType(p),
+		Timestamp:   time.Unix(0, timestamp).UTC().Format(time.RFC3339Nano),
+		Message:     strings.TrimSuffix(clean(msg), "\n"),
+	})
+	return string(line) + "\n"
+}
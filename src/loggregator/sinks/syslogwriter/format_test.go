@@ -0,0 +1,180 @@
+package syslogwriter_test
+
+import (
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"loggregator/sinks/syslogwriter"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Format", func() {
+	It("should frame RFC5424 messages with octet counting on stream transports only", func() {
+		for _, format := range []string{"", "rfc5424"} {
+			formatter, err := syslogwriter.NewFormatter(format, "", "syslog-tls", syslogwriter.Header{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(formatter(syslogwriter.PriorityStdout, "appId", "App", "2", "hi", 0)).To(MatchRegexp(`^\d+ <14>1 `))
+
+			formatter, err = syslogwriter.NewFormatter(format, "", "syslog-udp", syslogwriter.Header{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(formatter(syslogwriter.PriorityStdout, "appId", "App", "2", "hi", 0)).To(MatchRegexp(`^<14>1 `))
+		}
+	})
+
+	It("should reject unknown formats", func() {
+		_, err := syslogwriter.NewFormatter("xml", "", "syslog", syslogwriter.Header{})
+		Expect(err).To(MatchError("Unknown drain format: xml"))
+	})
+
+	It("should render messages as JSON lines", func() {
+		formatter, err := syslogwriter.NewFormatter("json", "", "syslog", syslogwriter.Header{})
+		Expect(err).ToNot(HaveOccurred())
+
+		timestamp := time.Date(2014, 3, 4, 5, 6, 7, 890000000, time.UTC)
+		line := formatter(syslogwriter.PriorityStderr, "appId", "App", "2", "first\nsecond\n", timestamp.UnixNano())
+		Expect(strings.Count(line, "\n")).To(Equal(1))
+		Expect(strings.HasSuffix(line, "\n")).To(BeTrue())
+
+		var event map[string]string
+		Expect(json.Unmarshal([]byte(line), &event)).To(Succeed())
+		Expect(event).To(Equal(map[string]string{
+			"app_id":       "appId",
+			"source_name":  "App",
+			"source_id":    "2",
+			"message_type": "ERR",
+			"timestamp":    "2014-03-04T05:06:07.89Z",
+			"message":      "first\nsecond",
+		}))
+	})
+
+	It("should mark stdout messages as OUT", func() {
+		line := syslogwriter.FormatJsonLine(syslogwriter.PriorityStdout, "appId", "RTR", "", "GET /", 0)
+		Expect(line).To(ContainSubstring(`"message_type":"OUT"`))
+	})
+
+	It("should reject unknown framings", func() {
+		_, err := syslogwriter.NewFormatter("rfc5424", "stuffing", "syslog", syslogwriter.Header{})
+		Expect(err).To(MatchError("Unknown drain framing: stuffing"))
+	})
+
+	It("should not frame messages on datagram transports", func() {
+		formatter, err := syslogwriter.NewFormatter("rfc3164", "octet-counting", "syslog-udp", syslogwriter.Header{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(formatter(syslogwriter.PriorityStdout, "appId", "App", "2", "hi", 0)).To(MatchRegexp(`^<14>\w{3} `))
+	})
+
+	Describe("parsing the framed messages back", func() {
+		timestamp := time.Date(2014, 3, 4, 5, 6, 7, 0, time.Local)
+		header := syslogwriter.Header{Hostname: "myhost", Facility: 16}
+
+		stream := func(formatter syslogwriter.Formatter) string {
+			return formatter(syslogwriter.PriorityStdout, "appId", "App", "2", "first line\n\tsecond line", timestamp.UnixNano()) +
+				formatter(syslogwriter.PriorityStderr, "appId", "RTR", "", "GET /", timestamp.UnixNano())
+		}
+
+		It("should frame RFC5424 messages with octet counting", func() {
+			formatter, err := syslogwriter.NewFormatter("rfc5424", "octet-counting", "syslog", header)
+			Expect(err).ToNot(HaveOccurred())
+
+			messages := parseOctetCounted(stream(formatter))
+			Expect(messages).To(HaveLen(2))
+			Expect(parseRFC5424(messages[0])).To(Equal([]string{"134", timestamp.Format(time.RFC3339), "myhost", "appId", "[App/2]", "-", "-", "first line\n\tsecond line"}))
+			Expect(parseRFC5424(messages[1])).To(Equal([]string{"131", timestamp.Format(time.RFC3339), "myhost", "appId", "[RTR]", "-", "-", "GET /"}))
+		})
+
+		It("should frame RFC5424 messages with newlines, escaping the ones within messages", func() {
+			formatter, err := syslogwriter.NewFormatter("rfc5424", "non-transparent", "syslog", header)
+			Expect(err).ToNot(HaveOccurred())
+
+			messages := parseNonTransparent(stream(formatter))
+			Expect(messages).To(HaveLen(2))
+			Expect(parseRFC5424(messages[0])[7]).To(Equal("first line\n\tsecond line"))
+			Expect(parseRFC5424(messages[1])[7]).To(Equal("GET /"))
+		})
+
+		It("should escape backslashes so literal \\n survives framing with newlines", func() {
+			formatter, err := syslogwriter.NewFormatter("rfc5424", "non-transparent", "syslog", header)
+			Expect(err).ToNot(HaveOccurred())
+
+			message := `C:\new\table` + "\n" + `literal \n and \\n`
+			framed := formatter(syslogwriter.PriorityStdout, "appId", "App", "2", message, timestamp.UnixNano())
+			Expect(framed).To(ContainSubstring(`C:\\new\\table\nliteral \\n and \\\\n`))
+
+			messages := parseNonTransparent(framed)
+			Expect(messages).To(HaveLen(1))
+			Expect(parseRFC5424(messages[0])[7]).To(Equal(message))
+		})
+
+		It("should frame RFC3164 messages with newlines by default", func() {
+			formatter, err := syslogwriter.NewFormatter("rfc3164", "", "syslog", header)
+			Expect(err).ToNot(HaveOccurred())
+
+			messages := parseNonTransparent(stream(formatter))
+			Expect(messages).To(HaveLen(2))
+			Expect(parseRFC3164(messages[0])).To(Equal([]string{"134", timestamp.Format(time.Stamp), "myhost", "appId", "App/2", "first line\n\tsecond line"}))
+			Expect(parseRFC3164(messages[1])).To(Equal([]string{"131", timestamp.Format(time.Stamp), "myhost", "appId", "RTR", "GET /"}))
+		})
+
+		It("should frame RFC3164 messages with octet counting if asked to", func() {
+			formatter, err := syslogwriter.NewFormatter("rfc3164", "octet-counting", "syslog", header)
+			Expect(err).ToNot(HaveOccurred())
+
+			messages := parseOctetCounted(stream(formatter))
+			Expect(messages).To(HaveLen(2))
+			Expect(parseRFC3164(messages[0])[5]).To(Equal("first line\n\tsecond line"))
+		})
+	})
+})
+
+func parseOctetCounted(stream string) []string {
+	var messages []string
+	for stream != "" {
+		space := strings.Index(stream, " ")
+		Expect(space).To(BeNumerically(">", 0))
+		length, err := strconv.Atoi(stream[:space])
+		Expect(err).ToNot(HaveOccurred())
+
+		stream = stream[space+1:]
+		Expect(len(stream)).To(BeNumerically(">=", length))
+		messages = append(messages, stream[:length])
+		stream = stream[length:]
+	}
+	return messages
+}
+
+func parseNonTransparent(stream string) []string {
+	Expect(strings.HasSuffix(stream, "\n")).To(BeTrue())
+	frames := strings.Split(strings.TrimSuffix(stream, "\n"), "\n")
+
+	messages := make([]string, 0, len(frames))
+	for _, frame := range frames {
+		messages = append(messages, nonTransparentUnescaper.Replace(frame)+"\n")
+	}
+	return messages
+}
+
+var nonTransparentUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+
+var rfc5424Message = regexp.MustCompile(`(?s)^<(\d+)>1 (\S+) (\S+) (\S+) (\S+) (\S+) (-|\[.*?[^\\]\]) (.*)\n$`)
+
+// parseRFC5424 returns the priority, timestamp, hostname, appname, procid,
+// msgid, structured data and message of a RFC5424 message.
+func parseRFC5424(message string) []string {
+	fields := rfc5424Message.FindStringSubmatch(message)
+	Expect(fields).ToNot(BeNil(), message)
+	fields[2] = strings.Replace(fields[2], "+00:00", "Z", 1)
+	return fields[1:]
+}
+
+var rfc3164Message = regexp.MustCompile(`(?s)^<(\d+)>(\w{3} [ \d]\d \d{2}:\d{2}:\d{2}) (\S+) ([^\[\s]+)\[([^\]]+)\]: (.*)\n$`)
+
+// parseRFC3164 returns the priority, timestamp, hostname, tag, pid and
+// message of a RFC3164 message.
+func parseRFC3164(message string) []string {
+	fields := rfc3164Message.FindStringSubmatch(message)
+	Expect(fields).ToNot(BeNil(), message)
+	return fields[1:]
+}
@@ -0,0 +1,149 @@
+package syslogwriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+const FormatGELF = "gelf"
+
+// GELF chunking as described in
+// http://docs.graylog.org/en/latest/pages/gelf.html#chunking
+const (
+	// GelfChunkSize is the payload of a chunk, small enough for a datagram
+	// not to be fragmented on the way to the drain.
+	GelfChunkSize = 1420
+	// GelfMaxChunks is the number of chunks Graylog accepts per message.
+	GelfMaxChunks = 128
+
+	gelfChunkHeaderSize = 12
+
+	// Uncompressed messages are cut down to this size, which leaves room
+	// for the gzip header and the worst case of incompressible data.
+	maxGelfMessageSize = GelfChunkSize*GelfMaxChunks - 1024
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// Syslog severities GELF uses as levels.
+const (
+	gelfLevelError = 3
+	gelfLevelInfo  = 6
+)
+
+type gelfMessage struct {
+	Version      string  `json:"version"`
+	Host         string  `json:"host"`
+	ShortMessage string  `json:"short_message"`
+	Timestamp    float64 `json:"timestamp"`
+	Level        int     `json:"level"`
+	SourceName   string  `json:"_source_name"`
+	Instance     string  `json:"_instance"`
+}
+
+// FormatGelfMessage renders a message as a GELF 1.1 message. The app id is
+// the host and the source name and id are the _source_name and _instance
+// fields.
+func FormatGelfMessage(p int, appId, source, sourceId, msg string, timestamp int64) string {
+	level := gelfLevelInfo
+	if p == PriorityStderr {
+		level = gelfLevelError
+	}
+
+	// A struct of strings and numbers always marshals.
+	message, _ := json.Marshal(gelfMessage{
+		Version:      "1.1",
+		Host:         appId,
+		ShortMessage: strings.TrimSuffix(clean(msg), "\n"),
+		Timestamp:    float64(timestamp/1e6) / 1e3,
+		Level:        level,
+		SourceName:   source,
+		Instance:     sourceId,
+	})
+	return string(message)
+}
+
+// FormatGelfFrame renders a GELF message framed with a null byte, as GELF
+// over TCP expects.
+func FormatGelfFrame(p int, appId, source, sourceId, msg string, timestamp int64) string {
+	return FormatGelfMessage(p, appId, source, sourceId, msg, timestamp) + "\000"
+}
+
+type gelfUdpWriter struct {
+	*udpWriter
+}
+
+// NewGelfUdpWriter returns a writer that sends every message as gzipped
+// GELF, split into chunks if it does not fit into a single datagram.
+// Messages too long for GelfMaxChunks chunks are truncated.
+func NewGelfUdpWriter(raddr string, appId string, resolver *Resolver) *gelfUdpWriter {
+	return &gelfUdpWriter{NewUdpSyslogWriter(raddr, appId, resolver, nil)}
+}
+
+func (w *gelfUdpWriter) WriteStdout(b []byte, source, sourceId string, timestamp int64) (int, error) {
+	return w.write(PriorityStdout, source, sourceId, string(b), timestamp)
+}
+
+func (w *gelfUdpWriter) WriteStderr(b []byte, source, sourceId string, timestamp int64) (int, error) {
+	return w.write(PriorityStderr, source, sourceId, string(b), timestamp)
+}
+
+func (w *gelfUdpWriter) write(p int, source, sourceId, msg string, timestamp int64) (int, error) {
+	message := FormatGelfMessage(p, w.appId, source, sourceId, msg, timestamp)
+	if len(message) > maxGelfMessageSize {
+		message = truncateMessage(FormatGelfMessage, maxGelfMessageSize, p, w.appId, source, sourceId, msg, timestamp)
+		atomic.AddUint64(w.truncatedMessageCount, 1)
+	}
+
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write([]byte(message))
+	gzipWriter.Close()
+
+	datagrams, err := GelfChunks(compressed.Bytes())
+	if err != nil {
+		atomic.AddUint64(w.writeErrorCount, 1)
+		return 0, err
+	}
+	return w.send(datagrams...)
+}
+
+// GelfChunks splits a message into GELF chunks. A message that fits into a
+// single chunk is returned as it is.
+func GelfChunks(message []byte) ([][]byte, error) {
+	if len(message) <= GelfChunkSize {
+		return [][]byte{message}, nil
+	}
+
+	count := (len(message) + GelfChunkSize - 1) / GelfChunkSize
+	if count > GelfMaxChunks {
+		return nil, fmt.Errorf("GELF message of %d bytes needs more than %d chunks", len(message), GelfMaxChunks)
+	}
+
+	messageId := make([]byte, 8)
+	_, err := rand.Read(messageId)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * GelfChunkSize
+		if end > len(message) {
+			end = len(message)
+		}
+
+		chunk := make([]byte, 0, gelfChunkHeaderSize+end-i*GelfChunkSize)
+		chunk = append(chunk, gelfChunkMagic...)
+		chunk = append(chunk, messageId...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, message[i*GelfChunkSize:end]...)
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
@@ -0,0 +1,168 @@
+package syslogwriter_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"loggregator/sinks/syslogwriter"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+var _ = Describe("GELF", func() {
+	It("should map log messages to GELF fields", func() {
+		timestamp := time.Date(2014, 3, 4, 5, 6, 7, 890000000, time.UTC)
+		message := syslogwriter.FormatGelfMessage(syslogwriter.PriorityStderr, "appId", "App", "2", "it failed\n", timestamp.UnixNano())
+
+		var event map[string]interface{}
+		Expect(json.Unmarshal([]byte(message), &event)).To(Succeed())
+		Expect(event["timestamp"]).To(BeNumerically("~", float64(timestamp.Unix())+0.89, 0.0001))
+		delete(event, "timestamp")
+		Expect(event).To(Equal(map[string]interface{}{
+			"version":       "1.1",
+			"host":          "appId",
+			"short_message": "it failed",
+			"level":         float64(3),
+			"_source_name":  "App",
+			"_instance":     "2",
+		}))
+	})
+
+	It("should log stdout messages at the info level", func() {
+		message := syslogwriter.FormatGelfMessage(syslogwriter.PriorityStdout, "appId", "RTR", "", "GET /", 0)
+		Expect(message).To(ContainSubstring(`"level":6`))
+	})
+
+	It("should frame messages for TCP with a null byte", func() {
+		formatter, err := syslogwriter.NewFormatter("gelf", "", "syslog", syslogwriter.Header{})
+		Expect(err).ToNot(HaveOccurred())
+
+		frame := formatter(syslogwriter.PriorityStdout, "appId", "App", "2", "a\000message", 0)
+		Expect(strings.Count(frame, "\000")).To(Equal(1))
+		Expect(strings.HasSuffix(frame, "\000")).To(BeTrue())
+		var event map[string]interface{}
+		Expect(json.Unmarshal([]byte(strings.TrimSuffix(frame, "\000")), &event)).To(Succeed())
+		Expect(event["short_message"]).To(Equal("amessage"))
+	})
+
+	It("should not chunk messages that fit into a chunk", func() {
+		chunks, err := syslogwriter.GelfChunks([]byte("message"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(chunks).To(Equal([][]byte{[]byte("message")}))
+	})
+
+	It("should split larger messages into numbered chunks of one message id", func() {
+		message := bytes.Repeat([]byte("x"), 2*syslogwriter.GelfChunkSize+1)
+		chunks, err := syslogwriter.GelfChunks(message)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(chunks).To(HaveLen(3))
+
+		for i, chunk := range chunks {
+			Expect(chunk[0:2]).To(Equal([]byte{0x1e, 0x0f}))
+			Expect(chunk[2:10]).To(Equal(chunks[0][2:10]))
+			Expect(chunk[10]).To(Equal(byte(i)))
+			Expect(chunk[11]).To(Equal(byte(3)))
+		}
+		Expect(reassemble(chunks)).To(Equal(message))
+	})
+
+	It("should refuse messages that need too many chunks", func() {
+		_, err := syslogwriter.GelfChunks(make([]byte, syslogwriter.GelfChunkSize*syslogwriter.GelfMaxChunks+1))
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("over UDP", func() {
+		var conn net.PacketConn
+		var writer syslogwriter.SyslogWriter
+
+		BeforeEach(func() {
+			var err error
+			conn, err = net.ListenPacket("udp", "localhost:12201")
+			Expect(err).ToNot(HaveOccurred())
+
+			writer = syslogwriter.NewSyslogWriter("gelf+udp", "localhost:12201", "appId", nil, 0, nil, nil)
+			Expect(writer.Connect()).To(Succeed())
+		})
+
+		AfterEach(func() {
+			writer.Close()
+			conn.Close()
+		})
+
+		readMessage := func(datagrams int) map[string]interface{} {
+			var chunks [][]byte
+			buffer := make([]byte, 65536)
+			for i := 0; i < datagrams; i++ {
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				n, _, err := conn.ReadFrom(buffer)
+				Expect(err).ToNot(HaveOccurred())
+				chunks = append(chunks, append([]byte(nil), buffer[:n]...))
+			}
+
+			compressed := chunks[0]
+			if datagrams > 1 {
+				compressed = reassemble(chunks)
+			}
+			gzipReader, err := gzip.NewReader(bytes.NewReader(compressed))
+			Expect(err).ToNot(HaveOccurred())
+			message, err := ioutil.ReadAll(gzipReader)
+			Expect(err).ToNot(HaveOccurred())
+
+			var event map[string]interface{}
+			Expect(json.Unmarshal(message, &event)).To(Succeed())
+			return event
+		}
+
+		It("should send gzipped GELF messages", func() {
+			_, err := writer.WriteStdout([]byte("just a test"), "App", "2", time.Now().UnixNano())
+			Expect(err).ToNot(HaveOccurred())
+
+			event := readMessage(1)
+			Expect(event["short_message"]).To(Equal("just a test"))
+			Expect(event["host"]).To(Equal("appId"))
+		})
+
+		It("should chunk messages that do not fit into a datagram", func() {
+			// Random letters hardly compress.
+			letters := make([]byte, 3*syslogwriter.GelfChunkSize)
+			for i := range letters {
+				letters[i] = byte('a' + rand.Intn(26))
+			}
+
+			n, err := writer.WriteStderr(letters, "App", "2", time.Now().UnixNano())
+			Expect(err).ToNot(HaveOccurred())
+
+			chunkLength := syslogwriter.GelfChunkSize + 12
+			event := readMessage((n + chunkLength - 1) / chunkLength)
+			Expect(event["short_message"]).To(Equal(string(letters)))
+			Expect(event["level"]).To(Equal(float64(3)))
+		})
+
+		It("should truncate messages that grow past the limit when escaped", func() {
+			message := strings.Repeat("<", 40*1024)
+
+			n, err := writer.WriteStdout([]byte(message), "App", "2", time.Now().UnixNano())
+			Expect(err).ToNot(HaveOccurred())
+
+			chunkLength := syslogwriter.GelfChunkSize + 12
+			event := readMessage((n + chunkLength - 1) / chunkLength)
+			shortMessage, _ := event["short_message"].(string)
+			Expect(shortMessage).ToNot(BeEmpty())
+			Expect(message).To(HavePrefix(shortMessage))
+			Expect(len(shortMessage)).To(BeNumerically("<", len(message)))
+		})
+	})
+})
+
+func reassemble(chunks [][]byte) []byte {
+	message := make([][]byte, len(chunks))
+	for _, chunk := range chunks {
+		message[chunk[10]] = chunk[12:]
+	}
+	return bytes.Join(message, nil)
+}
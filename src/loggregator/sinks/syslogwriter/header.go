@@ -0,0 +1,172 @@
+package syslogwriter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultHostname = "loggregator"
+	DefaultAppName  = "{app_id}"
+
+	// StructuredDataId names the SD element messages carry if requested,
+	// under the private enterprise number of the Cloud Foundry Foundation.
+	StructuredDataId = "cf@47450"
+
+	facilityUser  = 1
+	severityError = 3
+	severityInfo  = 6
+
+	maxHostnameLength = 255
+	maxAppNameLength  = 48
+	maxTagLength      = 32
+)
+
+var facilities = map[string]int{
+	"user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Header holds the RFC5424 header fields of the messages sent to a drain.
+// Zero values select the defaults: the loggregator hostname, the user
+// facility and the app id as appname. AppName may refer to {app_id},
+// {source_name} and {source_id}. With StructuredData, messages carry an
+// SD element with the app id, source name, source id and message type.
+type Header struct {
+	Hostname       string
+	Facility       int
+	AppName        string
+	StructuredData bool
+}
+
+// ParseFacility parses a syslog facility given by name, e.g. local0, or
+// number. The kernel facility is reserved for kernel messages.
+func ParseFacility(facility string) (int, error) {
+	if number, ok := facilities[facility]; ok {
+		return number, nil
+	}
+	number, err := strconv.Atoi(facility)
+	if err != nil || number < facilityUser || number > facilities["local7"] {
+		return 0, fmt.Errorf("Invalid syslog facility: %s", facility)
+	}
+	return number, nil
+}
+
+// Message renders a RFC5424 message.
+func (h Header) Message(p int, appId, source, sourceId, msg string, timestamp int64) string {
+	// ensure it ends in a \n
+	nl := ""
+	if !strings.HasSuffix(msg, "\n") {
+		nl = "\n"
+	}
+
+	msg = clean(msg)
+	timeString := time.Unix(0, timestamp).Format(time.RFC3339)
+	timeString = strings.Replace(timeString, "Z", "+00:00", 1)
+
+	var formattedSource string
+	if source == "App" {
+		formattedSource = fmt.Sprintf("[%s/%s]", source, sourceId)
+	} else {
+		formattedSource = fmt.Sprintf("[%s]", source)
+	}
+
+	structuredData := "-"
+	if h.StructuredData {
+		structuredData = fmt.Sprintf(`[%s app_id="%s" source="%s" instance="%s" type="%s"]`,
+			StructuredDataId, sdParamValue(appId), sdParamValue(source), sdParamValue(sourceId), messageType(p))
+	}
+
+	// syslog format https://tools.ietf.org/html/rfc5424#section-6
+	return fmt.Sprintf("<%d>1 %s %s %s %s - %s %s%s", h.priority(p), timeString, headerField(h.hostname(), maxHostnameLength),
+		headerField(h.appName(appId, source, sourceId), maxAppNameLength), formattedSource, structuredData, msg, nl)
+}
+
+// Frame renders a RFC5424 message framed with octet counting.
+func (h Header) Frame(p int, appId, source, sourceId, msg string, timestamp int64) string {
+	return octetCounted(h.Message)(p, appId, source, sourceId, msg, timestamp)
+}
+
+// RFC3164Message renders a message in the BSD syslog format of
+// https://tools.ietf.org/html/rfc3164#section-4.1 for receivers that do not
+// understand RFC5424. The appname is the tag and the source the pid. The
+// structured data element is left out.
+func (h Header) RFC3164Message(p int, appId, source, sourceId, msg string, timestamp int64) string {
+	nl := ""
+	if !strings.HasSuffix(msg, "\n") {
+		nl = "\n"
+	}
+
+	msg = clean(msg)
+	timeString := time.Unix(0, timestamp).Format(time.Stamp)
+
+	formattedSource := source
+	if source == "App" {
+		formattedSource = fmt.Sprintf("%s/%s", source, sourceId)
+	}
+
+	return fmt.Sprintf("<%d>%s %s %s[%s]: %s%s", h.priority(p), timeString, headerField(h.hostname(), maxHostnameLength),
+		headerField(h.appName(appId, source, sourceId), maxTagLength), formattedSource, msg, nl)
+}
+
+func (h Header) hostname() string {
+	if h.Hostname == "" {
+		return DefaultHostname
+	}
+	return h.Hostname
+}
+
+func (h Header) appName(appId, source, sourceId string) string {
+	appName := h.AppName
+	if appName == "" {
+		appName = DefaultAppName
+	}
+	return strings.NewReplacer("{app_id}", appId, "{source_name}", source, "{source_id}", sourceId).Replace(appName)
+}
+
+// priority turns the priority a message was written with into one of the
+// facility of the header.
+func (h Header) priority(p int) int {
+	facility := h.Facility
+	if facility == 0 {
+		facility = facilityUser
+	}
+	severity := severityInfo
+	if p == PriorityStderr {
+		severity = severityError
+	}
+	return facility*8 + severity
+}
+
+func messageType(p int) string {
+	if p == PriorityStderr {
+		return "ERR"
+	}
+	return "OUT"
+}
+
+// headerField makes value a valid header field of at most max printable
+// ASCII characters, or the nil value if it is empty.
+func headerField(value string, max int) string {
+	field := make([]byte, 0, len(value))
+	for i := 0; i < len(value) && len(field) < max; i++ {
+		if value[i] > ' ' && value[i] < 127 {
+			field = append(field, value[i])
+		} else {
+			field = append(field, '_')
+		}
+	}
+	if len(field) == 0 {
+		return "-"
+	}
+	return string(field)
+}
+
+// sdParamValue escapes the characters RFC5424 reserves in SD param values.
+func sdParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
@@ -0,0 +1,46 @@
+package syslogwriter_test
+
+import (
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"loggregator/sinks/syslogwriter"
+	"time"
+)
+
+var _ = Describe("Header", func() {
+	timestamp := time.Date(2014, 3, 4, 5, 6, 7, 0, time.UTC).UnixNano()
+
+	It("should default to the loggregator hostname, the user facility and the app id as appname", func() {
+		message := syslogwriter.Header{}.Message(syslogwriter.PriorityStderr, "appId", "App", "2", "just a test", timestamp)
+		Expect(message).To(MatchRegexp(`^<11>1 \S+ loggregator appId \[App/2\] - - just a test\n$`))
+	})
+
+	It("should use the configured hostname, facility and appname template", func() {
+		header := syslogwriter.Header{Hostname: "my host", Facility: 16, AppName: "{app_id}.{source_name}.{source_id}"}
+		message := header.Message(syslogwriter.PriorityStdout, "appId", "App", "2", "just a test", timestamp)
+		Expect(message).To(MatchRegexp(`^<134>1 \S+ my_host appId.App.2 \[App/2\] - - just a test\n$`))
+	})
+
+	It("should add a structured data element", func() {
+		header := syslogwriter.Header{StructuredData: true}
+		message := header.Message(syslogwriter.PriorityStderr, `app"Id]`, "RTR", "", "GET /", timestamp)
+		Expect(message).To(ContainSubstring(` [RTR] - [cf@47450 app_id="app\"Id\]" source="RTR" instance="" type="ERR"] GET /`))
+	})
+
+	It("should frame messages with octet counting", func() {
+		frame := syslogwriter.Header{}.Frame(syslogwriter.PriorityStdout, "appId", "App", "2", "hi", timestamp)
+		message := syslogwriter.Header{}.Message(syslogwriter.PriorityStdout, "appId", "App", "2", "hi", timestamp)
+		Expect(frame).To(Equal(fmt.Sprintf("%d %s", len(message), message)))
+	})
+
+	It("should parse facilities by name and number", func() {
+		Expect(syslogwriter.ParseFacility("local0")).To(Equal(16))
+		Expect(syslogwriter.ParseFacility("3")).To(Equal(3))
+
+		for _, facility := range []string{"kern", "0", "24", "local8"} {
+			_, err := syslogwriter.ParseFacility(facility)
+			Expect(err).To(MatchError("Invalid syslog facility: " + facility))
+		}
+	})
+})
@@ -0,0 +1,429 @@
+package syslogwriter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RELP as described in http://www.rsyslog.com/doc/relp.html
+const (
+	// RelpWindowSize is the number of messages sent without being
+	// acknowledged by the drain, as in rsyslog.
+	RelpWindowSize = 128
+
+	maxRelpTxnr        = 999999999
+	relpOffer          = "relp_version=0\nrelp_software=loggregator\ncommands=syslog"
+	relpOpenTimeout    = 30 * time.Second
+	maxRelpDataLength  = 128 * 1024
+	relpResponseOK     = "200"
+	relpServerCloseCmd = "serverclose"
+)
+
+var errNotConnected = errors.New("Not connected")
+
+type relpFrame struct {
+	txnr    int
+	message string
+}
+
+// relpSession is a RELP session on one connection.
+type relpSession struct {
+	conn     net.Conn
+	address  string
+	nextTxnr int
+	acked    chan struct{}
+	err      error
+}
+
+type relpWriter struct {
+	appId string
+	raddr string
+
+	connectedFlag
+
+	writeTimeout time.Duration
+	resolver     *Resolver
+	formatter    Formatter
+
+	sendMu sync.Mutex // serializes sending frames
+
+	mu      sync.Mutex // guards session and unacked
+	session *relpSession
+	unacked []*relpFrame
+
+	sentMessageCount   *uint64
+	resentMessageCount *uint64
+}
+
+// NewRelpWriter creates a writer that sends messages to a RELP drain, e.g.
+// rsyslog's imrelp. Up to RelpWindowSize messages may wait for the drain to
+// acknowledge them; writes block for up to writeTimeout while the window is
+// full. Messages that were sent but not acknowledged when the connection
+// failed are sent again after reconnecting. Messages are sent as RFC5424
+// unless a formatter is given.
+func NewRelpWriter(raddr string, appId string, writeTimeout time.Duration, resolver *Resolver, formatter Formatter) *relpWriter {
+	return &relpWriter{
+		appId:              appId,
+		raddr:              raddr,
+		writeTimeout:       writeTimeout,
+		resolver:           resolver,
+		formatter:          formatter,
+		sentMessageCount:   new(uint64),
+		resentMessageCount: new(uint64),
+	}
+}
+
+// Connect opens a RELP session and sends the messages the last session left
+// unacknowledged again.
+func (w *relpWriter) Connect() error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	w.closeSession()
+
+	conn, address, err := w.dial()
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	session := &relpSession{conn: conn, address: address, nextTxnr: 1, acked: make(chan struct{}, 1)}
+	err = w.open(session, reader)
+	if err != nil {
+		conn.Close()
+		if w.resolver != nil {
+			w.resolver.Failed(address)
+		}
+		return err
+	}
+
+	w.mu.Lock()
+	w.session = session
+	resend := w.unacked
+	w.unacked = nil
+	w.mu.Unlock()
+
+	go w.readResponses(session, reader)
+
+	for i, frame := range resend {
+		err = w.send(session, frame.message)
+		if err != nil {
+			// Keep the messages that were not sent again for the next session.
+			w.mu.Lock()
+			w.unacked = append(w.unacked, resend[i:]...)
+			w.mu.Unlock()
+			return err
+		}
+		atomic.AddUint64(w.resentMessageCount, 1)
+	}
+
+	w.SetConnected(true)
+	return nil
+}
+
+func (w *relpWriter) dial() (net.Conn, string, error) {
+	if w.resolver == nil {
+		conn, err := dialTCP(w.raddr)
+		return conn, w.raddr, err
+	}
+
+	addresses, err := w.resolver.Addresses()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, address := range addresses {
+		var conn net.Conn
+		conn, err = dialTCP(address)
+		if err == nil {
+			w.resolver.Succeeded(address)
+			return conn, address, nil
+		}
+		w.resolver.Failed(address)
+	}
+	return nil, "", err
+}
+
+func (w *relpWriter) open(session *relpSession, reader *bufio.Reader) error {
+	session.conn.SetDeadline(time.Now().Add(relpOpenTimeout))
+	defer session.conn.SetDeadline(time.Time{})
+
+	_, err := io.WriteString(session.conn, relpFrameString(session.nextTxnr, "open", relpOffer))
+	if err != nil {
+		return err
+	}
+	session.nextTxnr++
+
+	_, command, data, err := readRelpFrame(reader)
+	if err != nil {
+		return err
+	}
+	if command != "rsp" || !strings.HasPrefix(data, relpResponseOK) {
+		return fmt.Errorf("Drain refused RELP session: %s %s", command, data)
+	}
+	return nil
+}
+
+func (w *relpWriter) WriteStdout(b []byte, source, sourceId string, timestamp int64) (int, error) {
+	return w.write(PriorityStdout, source, sourceId, string(b), timestamp)
+}
+
+func (w *relpWriter) WriteStderr(b []byte, source, sourceId string, timestamp int64) (int, error) {
+	return w.write(PriorityStderr, source, sourceId, string(b), timestamp)
+}
+
+func (w *relpWriter) write(p int, source, sourceId, msg string, timestamp int64) (int, error) {
+	format := w.formatter
+	if format == nil {
+		format = formatMessage
+	}
+	message := strings.TrimSuffix(format(p, w.appId, source, sourceId, msg, timestamp), "\n")
+
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	w.mu.Lock()
+	session := w.session
+	w.mu.Unlock()
+	if session == nil {
+		return 0, errNotConnected
+	}
+
+	err := w.waitForWindow(session)
+	if err == nil {
+		err = w.send(session, message)
+	}
+	if err != nil {
+		w.SetConnected(false)
+		return 0, err
+	}
+	atomic.AddUint64(w.sentMessageCount, 1)
+	return len(message), nil
+}
+
+// waitForWindow waits until the drain acknowledged enough messages for one
+// more to be sent.
+func (w *relpWriter) waitForWindow(session *relpSession) error {
+	var timeout <-chan time.Time
+	if w.writeTimeout > 0 {
+		timer := time.NewTimer(w.writeTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		w.mu.Lock()
+		err, full := session.err, len(w.unacked) >= RelpWindowSize
+		w.mu.Unlock()
+		if err != nil || !full {
+			return err
+		}
+
+		select {
+		case <-session.acked:
+		case <-timeout:
+			err = errors.New("Timed out waiting for the drain to acknowledge messages")
+			w.fail(session, err)
+			return err
+		}
+	}
+}
+
+// send sends a message with the next transaction number of the session.
+// Messages that could not be sent completely are left to the caller, all
+// others are kept until the drain acknowledges them.
+func (w *relpWriter) send(session *relpSession, message string) error {
+	frame := &relpFrame{txnr: session.nextTxnr, message: message}
+	session.nextTxnr = session.nextTxnr%maxRelpTxnr + 1
+
+	w.mu.Lock()
+	err := session.err
+	if err == nil {
+		w.unacked = append(w.unacked, frame)
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if w.writeTimeout > 0 {
+		session.conn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
+	}
+	_, err = io.WriteString(session.conn, relpFrameString(frame.txnr, "syslog", message))
+	if err != nil {
+		w.mu.Lock()
+		w.removeFrame(frame.txnr)
+		w.mu.Unlock()
+		w.fail(session, err)
+	}
+	return err
+}
+
+// readResponses processes the responses of the drain until the session
+// fails.
+func (w *relpWriter) readResponses(session *relpSession, reader *bufio.Reader) {
+	for {
+		txnr, command, data, err := readRelpFrame(reader)
+		if err == nil && command == relpServerCloseCmd {
+			err = errors.New("Drain closed the RELP session")
+		}
+		if err == nil && command != "rsp" {
+			err = fmt.Errorf("Unexpected RELP command from drain: %s", command)
+		}
+		if err == nil && !strings.HasPrefix(data, relpResponseOK) {
+			err = fmt.Errorf("Drain did not accept message %d: %s", txnr, data)
+		}
+		if err != nil {
+			w.fail(session, err)
+			return
+		}
+
+		w.mu.Lock()
+		if w.session == session {
+			w.removeFrame(txnr)
+		}
+		w.mu.Unlock()
+
+		select {
+		case session.acked <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// removeFrame must be called with w.mu held.
+func (w *relpWriter) removeFrame(txnr int) {
+	for i, frame := range w.unacked {
+		if frame.txnr == txnr {
+			w.unacked = append(w.unacked[:i], w.unacked[i+1:]...)
+			return
+		}
+	}
+}
+
+// fail ends the session with err, keeping its unacknowledged messages.
+func (w *relpWriter) fail(session *relpSession, err error) {
+	w.mu.Lock()
+	if session.err == nil {
+		session.err = err
+		session.conn.Close()
+		if w.resolver != nil {
+			w.resolver.Failed(session.address)
+		}
+	}
+	w.mu.Unlock()
+
+	select {
+	case session.acked <- struct{}{}:
+	default:
+	}
+}
+
+// closeSession must be called with w.sendMu held.
+func (w *relpWriter) closeSession() {
+	w.mu.Lock()
+	session := w.session
+	w.session = nil
+	w.mu.Unlock()
+
+	if session != nil {
+		w.mu.Lock()
+		if session.err == nil {
+			session.err = errNotConnected
+			// Announce the end of the session; the drain will not wait for
+			// anything else anyway.
+			session.conn.SetWriteDeadline(time.Now().Add(time.Second))
+			io.WriteString(session.conn, relpFrameString(session.nextTxnr, "close", ""))
+			session.conn.Close()
+		}
+		w.mu.Unlock()
+	}
+}
+
+// Close ends the RELP session. Messages the drain did not acknowledge yet
+// are sent again if the writer connects again.
+func (w *relpWriter) Close() error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	w.closeSession()
+	return nil
+}
+
+func (w *relpWriter) Emit() instrumentation.Context {
+	w.mu.Lock()
+	unacked := len(w.unacked)
+	w.mu.Unlock()
+
+	return instrumentation.Context{Name: "relpWriter",
+		Metrics: []instrumentation.Metric{
+			instrumentation.Metric{Name: "sentMessageCount:" + w.appId, Value: atomic.LoadUint64(w.sentMessageCount)},
+			instrumentation.Metric{Name: "resentMessageCount:" + w.appId, Value: atomic.LoadUint64(w.resentMessageCount)},
+			instrumentation.Metric{Name: "unacknowledgedMessageCount:" + w.appId, Value: unacked},
+		},
+	}
+}
+
+func relpFrameString(txnr int, command, data string) string {
+	if data == "" {
+		return fmt.Sprintf("%d %s 0\n", txnr, command)
+	}
+	return fmt.Sprintf("%d %s %d %s\n", txnr, command, len(data), data)
+}
+
+// readRelpFrame reads a frame of the form TXNR SP COMMAND SP DATALEN
+// [SP DATA] LF.
+func readRelpFrame(reader *bufio.Reader) (txnr int, command string, data string, err error) {
+	header, err := reader.ReadString(' ')
+	if err != nil {
+		return
+	}
+	txnr, err = strconv.Atoi(strings.TrimSuffix(header, " "))
+	if err != nil {
+		return 0, "", "", fmt.Errorf("Invalid RELP transaction number: %q", header)
+	}
+
+	command, err = reader.ReadString(' ')
+	if err != nil {
+		return
+	}
+	command = strings.TrimSuffix(command, " ")
+
+	var length string
+	for {
+		var b byte
+		b, err = reader.ReadByte()
+		if err != nil {
+			return
+		}
+		if b == ' ' || b == '\n' {
+			break
+		}
+		length += string(b)
+	}
+	dataLength, err := strconv.Atoi(length)
+	if err != nil || dataLength < 0 || dataLength > maxRelpDataLength {
+		return 0, "", "", fmt.Errorf("Invalid RELP data length: %q", length)
+	}
+	if dataLength == 0 {
+		return
+	}
+
+	buffer := make([]byte, dataLength+1)
+	_, err = io.ReadFull(reader, buffer)
+	if err != nil {
+		return
+	}
+	if buffer[dataLength] != '\n' {
+		return 0, "", "", errors.New("Missing RELP frame trailer")
+	}
+	return txnr, command, string(buffer[:dataLength]), nil
+}
@@ -0,0 +1,180 @@
+package syslogwriter_test
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io"
+	"loggregator/sinks/syslogwriter"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var _ = Describe("RelpWriter", func() {
+	var server *relpServer
+	var writer syslogwriter.SyslogWriter
+
+	BeforeEach(func() {
+		server = startRelpServer("localhost:20514")
+		writer = syslogwriter.NewSyslogWriter("relp", "localhost:20514", "appId", nil, 100*time.Millisecond, nil, nil)
+	})
+
+	AfterEach(func() {
+		writer.Close()
+		server.stop()
+	})
+
+	unacknowledged := func() interface{} {
+		for _, metric := range writer.(instrumentation.Instrumentable).Emit().Metrics {
+			if metric.Name == "unacknowledgedMessageCount:appId" {
+				return metric.Value
+			}
+		}
+		return nil
+	}
+
+	It("should open a session and send messages the drain acknowledges", func() {
+		Expect(writer.Connect()).To(Succeed())
+		Expect(writer.IsConnected()).To(BeTrue())
+
+		_, err := writer.WriteStdout([]byte("just a test\n"), "App", "2", time.Now().UnixNano())
+		Expect(err).ToNot(HaveOccurred())
+
+		var message string
+		Eventually(server.messages).Should(Receive(&message))
+		Expect(message).To(MatchRegexp(`^<14>1 \S+ loggregator appId \[App/2\] - - just a test$`))
+		Eventually(unacknowledged).Should(Equal(0))
+	})
+
+	It("should send unacknowledged messages again after reconnecting", func() {
+		server.dropConnections(true)
+		Expect(writer.Connect()).To(Succeed())
+
+		_, err := writer.WriteStdout([]byte("first"), "App", "2", time.Now().UnixNano())
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(server.messages).Should(Receive(ContainSubstring("first")))
+		Expect(unacknowledged()).To(Equal(1))
+
+		Eventually(func() error {
+			_, err := writer.WriteStdout([]byte("second"), "App", "2", time.Now().UnixNano())
+			return err
+		}).Should(HaveOccurred())
+		Expect(writer.IsConnected()).To(BeFalse())
+
+		server.dropConnections(false)
+		Expect(writer.Connect()).To(Succeed())
+		Eventually(server.messages).Should(Receive(ContainSubstring("first")))
+		Eventually(unacknowledged).Should(Equal(0))
+	})
+
+	It("should fail writes once the window stays full", func() {
+		server.withholdAcks(true)
+		Expect(writer.Connect()).To(Succeed())
+
+		go func() {
+			for _ = range server.messages {
+			}
+		}()
+
+		for i := 0; i < syslogwriter.RelpWindowSize; i++ {
+			_, err := writer.WriteStdout([]byte("message"), "App", "2", time.Now().UnixNano())
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err := writer.WriteStdout([]byte("one too many"), "App", "2", time.Now().UnixNano())
+		Expect(err).To(MatchError("Timed out waiting for the drain to acknowledge messages"))
+		Expect(writer.IsConnected()).To(BeFalse())
+	})
+})
+
+type relpServer struct {
+	listener net.Listener
+	messages chan string
+	drop     int32
+	withhold int32
+}
+
+func startRelpServer(address string) *relpServer {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		panic(err)
+	}
+
+	server := &relpServer{listener: listener, messages: make(chan string, syslogwriter.RelpWindowSize+1)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *relpServer) stop() {
+	s.listener.Close()
+}
+
+func (s *relpServer) dropConnections(drop bool) {
+	if drop {
+		atomic.StoreInt32(&s.drop, 1)
+	} else {
+		atomic.StoreInt32(&s.drop, 0)
+	}
+}
+
+func (s *relpServer) withholdAcks(withhold bool) {
+	if withhold {
+		atomic.StoreInt32(&s.withhold, 1)
+	} else {
+		atomic.StoreInt32(&s.withhold, 0)
+	}
+}
+
+func (s *relpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		txnr, command, data, err := readTestRelpFrame(reader)
+		if err != nil {
+			return
+		}
+
+		switch command {
+		case "open":
+			fmt.Fprintf(conn, "%s rsp 6 200 OK\n", txnr)
+		case "syslog":
+			s.messages <- data
+			if atomic.LoadInt32(&s.drop) == 1 {
+				return
+			}
+			if atomic.LoadInt32(&s.withhold) == 0 {
+				fmt.Fprintf(conn, "%s rsp 6 200 OK\n", txnr)
+			}
+		case "close":
+			fmt.Fprintf(conn, "%s rsp 0\n", txnr)
+			return
+		}
+	}
+}
+
+func readTestRelpFrame(reader *bufio.Reader) (txnr, command, data string, err error) {
+	var length int
+	_, err = fmt.Fscanf(reader, "%s %s %d", &txnr, &command, &length)
+	if err != nil {
+		return
+	}
+
+	// Either the trailer or the space before the data.
+	_, err = reader.ReadByte()
+	if err != nil || length == 0 {
+		return
+	}
+	buffer := make([]byte, length+1)
+	_, err = io.ReadFull(reader, buffer)
+	return txnr, command, string(buffer[:length]), err
+}
@@ -0,0 +1,175 @@
+package syslogwriter
+
+import (
+	"fmt"
+	"loggregator/iprange"
+	"net"
+	"sync"
+	"time"
+)
+
+// lookupTimeout bounds how long resolving a drain host may take.
+const lookupTimeout = 10 * time.Second
+
+// Resolver keeps track of the addresses of a drain host. It resolves the
+// host again once the addresses are older than the TTL, leaves out
+// blacklisted addresses and moves on to the next address when one fails.
+type Resolver struct {
+	host      string
+	port      string
+	ttl       time.Duration
+	blacklist []iprange.IPRange
+
+	sync.Mutex // guards the fields below
+	addresses  []string
+	resolvedAt time.Time
+	preferred  int
+}
+
+// NewResolver creates a Resolver for raddr, which is of the form host:port.
+// A zero ttl resolves the host on every call to Addresses.
+func NewResolver(raddr string, ttl time.Duration, blacklist []iprange.IPRange) (*Resolver, error) {
+	host, port, err := net.SplitHostPort(raddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Resolver{host: host, port: port, ttl: ttl, blacklist: blacklist}, nil
+}
+
+// Host returns the host name the Resolver resolves.
+func (r *Resolver) Host() string {
+	return r.host
+}
+
+// Addresses returns the addresses to connect to, in the order to try them.
+func (r *Resolver) Addresses() ([]string, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.stale() {
+		err := r.resolve()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	addresses := make([]string, 0, len(r.addresses))
+	for i := range r.addresses {
+		addresses = append(addresses, r.addresses[(r.preferred+i)%len(r.addresses)])
+	}
+	return addresses, nil
+}
+
+// Stale reports whether the addresses are due to be resolved again. It is
+// always false with a zero TTL, which only resolves the host on connecting.
+func (r *Resolver) Stale() bool {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.ttl > 0 && r.stale()
+}
+
+func (r *Resolver) stale() bool {
+	return r.addresses == nil || time.Since(r.resolvedAt) >= r.ttl
+}
+
+func (r *Resolver) resolve() error {
+	ipAddresses, err := lookup(r.host, lookupTimeout)
+	if err != nil {
+		return err
+	}
+
+	previous := ""
+	if len(r.addresses) > 0 {
+		previous = r.addresses[r.preferred]
+	}
+
+	var addresses []string
+	for _, ipAddress := range ipAddresses {
+		if iprange.IpInRanges(ipAddress, r.blacklist) {
+			continue
+		}
+		addresses = append(addresses, net.JoinHostPort(ipAddress.String(), r.port))
+	}
+	if len(addresses) == 0 {
+		return fmt.Errorf("All addresses of %s are blacklisted", r.host)
+	}
+
+	r.addresses = addresses
+	r.resolvedAt = time.Now()
+	r.preferred = 0
+	for i, address := range addresses {
+		if address == previous {
+			r.preferred = i
+		}
+	}
+	return nil
+}
+
+// Resolves reports whether address is still one of the addresses of the
+// host, resolving it again if the addresses are stale. If the host cannot
+// be resolved it keeps to address until the next attempt after the TTL, so
+// a failing lookup does not break a healthy connection.
+func (r *Resolver) Resolves(address string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.stale() && r.resolve() != nil {
+		r.resolvedAt = time.Now()
+		return true
+	}
+	for _, a := range r.addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Failed makes the address after the failed one the first to try.
+func (r *Resolver) Failed(address string) {
+	r.Lock()
+	defer r.Unlock()
+
+	for i, a := range r.addresses {
+		if a == address {
+			r.preferred = (i + 1) % len(r.addresses)
+			return
+		}
+	}
+}
+
+// Succeeded makes address the first to try.
+func (r *Resolver) Succeeded(address string) {
+	r.Lock()
+	defer r.Unlock()
+
+	for i, a := range r.addresses {
+		if a == address {
+			r.preferred = i
+			return
+		}
+	}
+}
+
+type lookupResult struct {
+	ipAddresses []net.IP
+	err         error
+}
+
+// lookup resolves host, giving up after timeout. A lookup that is given up
+// on finishes in the background.
+func lookup(host string, timeout time.Duration) ([]net.IP, error) {
+	result := make(chan lookupResult, 1)
+	go func() {
+		ipAddresses, err := iprange.ResolveHost(host)
+		result <- lookupResult{ipAddresses, err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.ipAddresses, r.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("Resolving host %s timed out after %v", host, timeout)
+	}
+}
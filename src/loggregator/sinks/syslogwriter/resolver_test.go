@@ -0,0 +1,62 @@
+package syslogwriter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"loggregator/iprange"
+	"loggregator/sinks/syslogwriter"
+	"time"
+)
+
+var _ = Describe("Resolver", func() {
+	It("should resolve IP addresses to themselves", func() {
+		resolver, err := syslogwriter.NewResolver("10.0.0.1:514", time.Minute, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(resolver.Addresses()).To(Equal([]string{"10.0.0.1:514"}))
+		Expect(resolver.Resolves("10.0.0.1:514")).To(BeTrue())
+		Expect(resolver.Resolves("10.0.0.2:514")).To(BeFalse())
+	})
+
+	It("should resolve host names", func() {
+		resolver, err := syslogwriter.NewResolver("localhost:514", time.Minute, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		addresses, err := resolver.Addresses()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addresses).ToNot(BeEmpty())
+		Expect(resolver.Host()).To(Equal("localhost"))
+	})
+
+	It("should reject addresses without a port", func() {
+		_, err := syslogwriter.NewResolver("localhost", time.Minute, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should leave out blacklisted addresses", func() {
+		resolver, _ := syslogwriter.NewResolver("127.0.0.1:514", time.Minute, []iprange.IPRange{{Start: "127.0.0.0", End: "127.0.0.255"}})
+
+		_, err := resolver.Addresses()
+		Expect(err).To(MatchError("All addresses of 127.0.0.1 are blacklisted"))
+	})
+
+	It("should keep to the address when the host cannot be resolved again", func() {
+		resolver, _ := syslogwriter.NewResolver("127.0.0.1:514", time.Minute, []iprange.IPRange{{Start: "127.0.0.0", End: "127.0.0.255"}})
+
+		Expect(resolver.Resolves("127.0.0.1:514")).To(BeTrue())
+	})
+
+	It("should only become stale after the TTL", func() {
+		resolver, _ := syslogwriter.NewResolver("10.0.0.1:514", 50*time.Millisecond, nil)
+		Expect(resolver.Stale()).To(BeTrue())
+
+		resolver.Addresses()
+		Expect(resolver.Stale()).To(BeFalse())
+		Eventually(resolver.Stale).Should(BeTrue())
+	})
+
+	It("should never become stale without a TTL", func() {
+		resolver, _ := syslogwriter.NewResolver("10.0.0.1:514", 0, nil)
+		Expect(resolver.Stale()).To(BeFalse())
+	})
+})
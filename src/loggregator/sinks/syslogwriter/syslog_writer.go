@@ -7,13 +7,27 @@ package syslogwriter
 
 import (
 	"crypto/tls"
-	"fmt"
+	"errors"
+	"io"
 	"net"
 	"strings"
 	"sync"
 	"time"
 )
 
+// Syslog priorities (facility user) for the two app output streams.
+const (
+	PriorityStdout = 14
+	PriorityStderr = 11
+)
+
+const (
+	dialTimeout     = 30 * time.Second
+	keepAlivePeriod = 30 * time.Second
+)
+
+var errClosedByDrain = errors.New("Connection closed by drain")
+
 type SyslogWriter interface {
 	Connect() error
 	WriteStdout(b []byte, source, sourceId string, timestamp int64) (int, error)
@@ -28,75 +42,177 @@ type writer struct {
 	raddr  string
 	scheme string
 
-	connected bool
+	connectedFlag
 
-	mu   sync.Mutex // guards conn
-	conn net.Conn
+	mu      sync.Mutex // guards conn, address and closed; writes happen without it
+	conn    net.Conn
+	address string
+	closed  <-chan struct{}
 
-	tlsConfig *tls.Config
+	writeTimeout time.Duration
+	tlsConfig    *TLSConfig
+	resolver     *Resolver
+	formatter    Formatter
 }
 
-func NewSyslogWriter(scheme, raddr string, appId string, skipCertVerify bool) (w *writer) {
-	tlsConfig := &tls.Config{InsecureSkipVerify: skipCertVerify}
+// NewSyslogWriter creates a writer for the drain at raddr. If resolver is
+// not nil, it is used to connect to the addresses of the drain host in turn
+// and to move to other addresses once the current one is no longer
+// resolved. Messages are written as octet counted RFC5424 frames unless a
+// formatter is given. The gelf+udp scheme sends chunked GELF datagrams and
+// the relp scheme sends messages to RELP drains.
+//
+// The syslog-tls scheme connects with tlsConfig, which verifies the drain
+// against the system roots by its host name if nil. A given tls.Config has
+// to name the server unless it skips verification.
+//
+// Writes that take longer than writeTimeout, which is not limited if zero,
+// and writes to connections the drain closed fail and disconnect the
+// writer. TCP keepalives detect drains that went away without closing the
+// connection.
+func NewSyslogWriter(scheme, raddr string, appId string, tlsConfig *TLSConfig, writeTimeout time.Duration, resolver *Resolver, formatter Formatter) SyslogWriter {
+	switch scheme {
+	case "syslog-udp":
+		return NewUdpSyslogWriter(raddr, appId, resolver, formatter)
+	case "gelf+udp":
+		return NewGelfUdpWriter(raddr, appId, resolver)
+	case "relp":
+		return NewRelpWriter(raddr, appId, writeTimeout, resolver, formatter)
+	}
+
+	if tlsConfig == nil {
+		tlsConfig = &TLSConfig{}
+	}
+	if tlsConfig.Config == nil {
+		serverName, _, _ := net.SplitHostPort(raddr)
+		if resolver != nil {
+			serverName = resolver.Host()
+		}
+		tlsConfig = &TLSConfig{Config: &tls.Config{ServerName: serverName}, Fingerprint: tlsConfig.Fingerprint}
+	}
 	return &writer{
 		appId:     appId,
 		raddr:     raddr,
-		connected: false,
 		scheme:    scheme,
 		tlsConfig: tlsConfig,
+		resolver:  resolver,
+		formatter: formatter,
+
+		writeTimeout: writeTimeout,
 	}
 }
 
+// Connect connects to the syslog server, trying all of its addresses in
+// turn. The lock is only held to swap the connection, so a slow dial does
+// not hold up Close.
 func (w *writer) Connect() error {
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	previous := w.conn
+	w.conn = nil
+	w.mu.Unlock()
+	if previous != nil {
+		// ignore err from close, it makes sense to continue anyway
+		previous.Close()
+	}
 
-	var err error
-	if strings.Contains(w.scheme, "syslog-tls") {
-		err = w.connectTLS()
-	} else {
-		err = w.connect()
+	conn, address, err := w.connect()
+	if err != nil {
+		return err
 	}
-	if err == nil {
-		w.SetConnected(true)
+
+	w.mu.Lock()
+	w.conn = conn
+	w.closed = watch(conn)
+	w.address = address
+	w.mu.Unlock()
+
+	w.SetConnected(true)
+	return nil
+}
+
+// connect makes a connection to the syslog server and returns the address
+// it connected to.
+func (w *writer) connect() (net.Conn, string, error) {
+	if w.resolver == nil {
+		c, err := w.dial(w.raddr)
+		return c, w.raddr, err
+	}
+
+	addresses, err := w.resolver.Addresses()
+	if err != nil {
+		return nil, "", err
 	}
-	return err
+	for _, address := range addresses {
+		var c net.Conn
+		c, err = w.dial(address)
+		if err == nil {
+			w.resolver.Succeeded(address)
+			return c, address, nil
+		}
+		w.resolver.Failed(address)
+	}
+	return nil, "", err
 }
 
-// connect makes a connection to the syslog server.
-// It must be called with w.mu held.
-func (w *writer) connect() (err error) {
-	if w.conn != nil {
-		// ignore err from close, it makes sense to continue anyway
-		w.conn.Close()
-		w.conn = nil
+func (w *writer) dial(address string) (net.Conn, error) {
+	conn, err := dialTCP(address)
+	if err != nil || !strings.Contains(w.scheme, "syslog-tls") {
+		return conn, err
 	}
-	c, err := net.Dial("tcp", w.raddr)
-	if err == nil {
-		w.conn = c
+
+	tlsConn := tls.Client(conn, w.tlsConfig.Config)
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	err = tlsConn.Handshake()
+	conn.SetDeadline(time.Time{})
+	if err == nil && w.tlsConfig.Fingerprint != nil {
+		err = verifyFingerprint(tlsConn.ConnectionState(), w.tlsConfig.Fingerprint)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
-	return
+	return tlsConn, nil
 }
 
-func (w *writer) connectTLS() (err error) {
-	if w.conn != nil {
-		// ignore err from close, it makes sense to continue anyway
-		w.conn.Close()
-		w.conn = nil
+// dialTCP connects to address with TCP keepalives, which detect drains that
+// went away without closing the connection.
+func dialTCP(address string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return nil, err
 	}
-	c, err := tls.Dial("tcp", w.raddr, w.tlsConfig)
-	if err == nil {
-		w.conn = c
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(keepAlivePeriod)
 	}
-	return
+	return conn, nil
+}
+
+// watch returns a channel that is closed once reading from conn fails.
+// Syslog drains never send anything, so this only happens once the drain
+// closed the connection, or it was reset or closed locally. Writes to such
+// a half-open connection would otherwise succeed until the drain resets it.
+func watch(conn net.Conn) <-chan struct{} {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		buffer := make([]byte, 512)
+		for {
+			_, err := conn.Read(buffer)
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return closed
 }
 
 func (w *writer) WriteStdout(b []byte, source, sourceId string, timestamp int64) (int, error) {
-	return w.write(14, source, sourceId, string(b), timestamp)
+	return w.write(PriorityStdout, source, sourceId, string(b), timestamp)
 }
 
 func (w *writer) WriteStderr(b []byte, source, sourceId string, timestamp int64) (int, error) {
-	return w.write(11, source, sourceId, string(b), timestamp)
+	return w.write(PriorityStderr, source, sourceId, string(b), timestamp)
 }
 
 func (w *writer) Close() error {
@@ -112,41 +228,75 @@ func (w *writer) Close() error {
 }
 
 func (w *writer) write(p int, source, sourceId, msg string, timestamp int64) (byte_count int, err error) {
-	// ensure it ends in a \n
-	nl := ""
-	if !strings.HasSuffix(msg, "\n") {
-		nl = "\n"
+	format := w.formatter
+	if format == nil {
+		format = FormatFrame
 	}
+	frame := format(p, w.appId, source, sourceId, msg, timestamp)
 
-	msg = clean(msg)
-	timeString := time.Unix(0, timestamp).Format(time.RFC3339)
-	timeString = strings.Replace(timeString, "Z", "+00:00", 1)
+	w.mu.Lock()
+	conn, closed, address := w.conn, w.closed, w.address
+	w.mu.Unlock()
 
-	var formattedSource string
-	if source == "App" {
-		formattedSource = fmt.Sprintf("[%s/%s]", source, sourceId)
-	} else {
-		formattedSource = fmt.Sprintf("[%s]", source)
+	// Resolving happens without holding the lock, as it may take a while.
+	if conn != nil && w.resolver != nil && w.resolver.Stale() && !w.resolver.Resolves(address) {
+		// The drain host moved away from the address we are connected to.
+		err = w.Connect()
+		if err != nil {
+			w.SetConnected(false)
+			return 0, err
+		}
+
+		w.mu.Lock()
+		conn, closed, address = w.conn, w.closed, w.address
+		w.mu.Unlock()
+	}
+	if conn == nil {
+		return 0, nil
+	}
+
+	select {
+	case <-closed:
+		err = errClosedByDrain
+	default:
+		if w.writeTimeout > 0 {
+			conn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
+		}
+		byte_count, err = io.WriteString(conn, frame)
+	}
+
+	if err != nil {
+		// The connection is of no use anymore, even after a timeout, as
+		// part of the frame may have been written.
+		w.disconnect(conn)
+		if w.resolver != nil {
+			w.resolver.Failed(address)
+		}
 	}
-	// syslog format https://tools.ietf.org/html/rfc5424#section-6
-	syslogMsg := fmt.Sprintf("<%d>1 %s %s %s %s - - %s%s", p, timeString, "loggregator", w.appId, formattedSource, msg, nl)
 
-	// Frame msg with Octet Counting: https://tools.ietf.org/html/rfc6587#section-3.4.1
+	return byte_count, err
+}
+
+// disconnect closes conn and forgets it unless it was replaced meanwhile.
+func (w *writer) disconnect(conn net.Conn) {
 	w.mu.Lock()
-	if w.conn != nil {
-		byte_count, err = fmt.Fprintf(w.conn, "%d %s", len(syslogMsg), syslogMsg)
+	if w.conn == conn {
+		w.conn = nil
 	}
 	w.mu.Unlock()
 
-	return byte_count, err
+	conn.Close()
+	w.SetConnected(false)
 }
 
-func (w *writer) IsConnected() bool {
-	return w.connected
+// FormatFrame renders a RFC5424 message with the default header fields,
+// framed with octet counting.
+func FormatFrame(p int, appId, source, sourceId, msg string, timestamp int64) string {
+	return Header{}.Frame(p, appId, source, sourceId, msg, timestamp)
 }
 
-func (w *writer) SetConnected(newValue bool) {
-	w.connected = newValue
+func formatMessage(p int, appId, source, sourceId, msg string, timestamp int64) string {
+	return Header{}.Message(p, appId, source, sourceId, msg, timestamp)
 }
 
 func clean(in string) string {
@@ -3,14 +3,19 @@ package syslogwriter_test
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
 	"github.com/cloudfoundry/gosteno"
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
 	"github.com/cloudfoundry/loggregatorlib/loggertesthelper"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"loggregator/iprange"
 	"loggregator/sinks/syslogwriter"
 	"math/big"
 	"net"
@@ -31,7 +36,7 @@ var _ = Describe("SyslogWriter", func() {
 		BeforeEach(func() {
 			shutdownChan = make(chan bool)
 			dataChan, serverStoppedChan = startSyslogServer(shutdownChan)
-			sysLogWriter = syslogwriter.NewSyslogWriter("syslog", "localhost:9999", "appId", false)
+			sysLogWriter = syslogwriter.NewSyslogWriter("syslog", "localhost:9999", "appId", nil, 0, nil, nil)
 			sysLogWriter.Connect()
 		})
 
@@ -76,6 +81,185 @@ var _ = Describe("SyslogWriter", func() {
 		})
 	})
 
+	Context("With a resolver", func() {
+		var dataChan <-chan []byte
+		var serverStoppedChan <-chan bool
+		var shutdownChan chan bool
+
+		BeforeEach(func() {
+			shutdownChan = make(chan bool)
+			dataChan, serverStoppedChan = startSyslogServer(shutdownChan)
+		})
+
+		AfterEach(func() {
+			close(shutdownChan)
+			<-serverStoppedChan
+		})
+
+		It("should connect to one of the resolved addresses", func(done Done) {
+			resolver, err := syslogwriter.NewResolver("localhost:9999", time.Minute, nil)
+			Expect(err).ToNot(HaveOccurred())
+			w := syslogwriter.NewSyslogWriter("syslog", "localhost:9999", "appId", nil, 0, resolver, nil)
+			defer w.Close()
+
+			Expect(w.Connect()).To(Succeed())
+			w.WriteStdout([]byte("just a test"), "test", "", time.Now().UnixNano())
+			Expect(string(<-dataChan)).To(ContainSubstring("just a test"))
+			close(done)
+		})
+
+		It("should not connect to blacklisted addresses", func() {
+			resolver, err := syslogwriter.NewResolver("127.0.0.1:9999", time.Minute, []iprange.IPRange{{Start: "127.0.0.0", End: "127.0.0.255"}})
+			Expect(err).ToNot(HaveOccurred())
+			w := syslogwriter.NewSyslogWriter("syslog", "127.0.0.1:9999", "appId", nil, 0, resolver, nil)
+
+			Expect(w.Connect()).To(MatchError("All addresses of 127.0.0.1 are blacklisted"))
+		})
+	})
+
+	Context("With a drain that misbehaves", func() {
+		var listener net.Listener
+		var accepted chan net.Conn
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "localhost:9999")
+			Expect(err).ToNot(HaveOccurred())
+
+			accepted = make(chan net.Conn, 1)
+			go func() {
+				conn, err := listener.Accept()
+				if err == nil {
+					accepted <- conn
+				}
+			}()
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		It("should disconnect when a write hangs because the drain stopped reading", func(done Done) {
+			w := syslogwriter.NewSyslogWriter("syslog", "localhost:9999", "appId", nil, 100*time.Millisecond, nil, nil)
+			defer w.Close()
+			Expect(w.Connect()).To(Succeed())
+			w.SetConnected(true)
+			conn := <-accepted
+			defer conn.Close()
+
+			message := []byte(strings.Repeat("a", 64*1024))
+			var err error
+			for err == nil {
+				_, err = w.WriteStdout(message, "App", "2", time.Now().UnixNano())
+			}
+			Expect(err.(net.Error).Timeout()).To(BeTrue())
+			Expect(w.IsConnected()).To(BeFalse())
+			close(done)
+		}, 10)
+
+		It("should disconnect once the drain closed the connection", func(done Done) {
+			w := syslogwriter.NewSyslogWriter("syslog", "localhost:9999", "appId", nil, time.Second, nil, nil)
+			defer w.Close()
+			Expect(w.Connect()).To(Succeed())
+			w.SetConnected(true)
+			(<-accepted).Close()
+
+			Eventually(func() error {
+				_, err := w.WriteStdout([]byte("just a test"), "App", "2", time.Now().UnixNano())
+				return err
+			}).Should(MatchError("Connection closed by drain"))
+			Expect(w.IsConnected()).To(BeFalse())
+			Expect(w.Close()).To(Succeed())
+			close(done)
+		})
+	})
+
+	Context("With the JSON format", func() {
+		var dataChan <-chan []byte
+		var serverStoppedChan <-chan bool
+		var shutdownChan chan bool
+
+		BeforeEach(func() {
+			shutdownChan = make(chan bool)
+			dataChan, serverStoppedChan = startSyslogServer(shutdownChan)
+		})
+
+		AfterEach(func() {
+			close(shutdownChan)
+			<-serverStoppedChan
+		})
+
+		It("should send newline delimited JSON objects", func(done Done) {
+			w := syslogwriter.NewSyslogWriter("syslog", "localhost:9999", "appId", nil, 0, nil, syslogwriter.FormatJsonLine)
+			defer w.Close()
+			Expect(w.Connect()).To(Succeed())
+
+			w.WriteStdout([]byte("just a test"), "App", "2", time.Now().UnixNano())
+			Expect(string(<-dataChan)).To(MatchRegexp(`^\{"app_id":"appId","source_name":"App","source_id":"2","message_type":"OUT","timestamp":"[^"]+","message":"just a test"\}\n$`))
+			close(done)
+		})
+	})
+
+	Context("With UDP Connection", func() {
+
+		var dataChan <-chan []byte
+		var serverStoppedChan <-chan bool
+		var shutdownChan chan bool
+		var sysLogWriter syslogwriter.SyslogWriter
+
+		BeforeEach(func() {
+			shutdownChan = make(chan bool)
+			dataChan, serverStoppedChan = startUdpSyslogServer(shutdownChan)
+			sysLogWriter = syslogwriter.NewSyslogWriter("syslog-udp", "localhost:9999", "appId", nil, 0, nil, nil)
+			sysLogWriter.Connect()
+		})
+
+		AfterEach(func() {
+			close(shutdownChan)
+			sysLogWriter.Close()
+			<-serverStoppedChan
+		})
+
+		It("should send one unframed message per datagram", func(done Done) {
+			sysLogWriter.WriteStdout([]byte("just a test"), "App", "2", time.Now().UnixNano())
+
+			data := <-dataChan
+			Expect(string(data)).To(MatchRegexp(`^<14>1 \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}([-+]\d{2}:\d{2}) loggregator appId \[App/2\] - - just a test\n$`))
+			close(done)
+		})
+
+		It("should truncate messages that do not fit into a datagram", func(done Done) {
+			message := strings.Repeat("a", syslogwriter.MaxUdpMessageSize)
+			sysLogWriter.WriteStderr([]byte(message), "App", "2", time.Now().UnixNano())
+
+			data := <-dataChan
+			Expect(data).To(HaveLen(syslogwriter.MaxUdpMessageSize))
+			Expect(string(data)).To(MatchRegexp(`^<11>1 `))
+
+			metrics := sysLogWriter.(instrumentation.Instrumentable).Emit().Metrics
+			Expect(metrics).To(ContainElement(instrumentation.Metric{Name: "sentDatagramCount:appId", Value: uint64(1)}))
+			Expect(metrics).To(ContainElement(instrumentation.Metric{Name: "truncatedMessageCount:appId", Value: uint64(1)}))
+			close(done)
+		})
+
+		It("should truncate JSON messages within the message field", func(done Done) {
+			jsonWriter := syslogwriter.NewSyslogWriter("syslog-udp", "localhost:9999", "appId", nil, 0, nil, syslogwriter.FormatJsonLine)
+			Expect(jsonWriter.Connect()).To(Succeed())
+			defer jsonWriter.Close()
+
+			message := strings.Repeat("<", syslogwriter.MaxUdpMessageSize)
+			jsonWriter.WriteStdout([]byte(message), "App", "2", time.Now().UnixNano())
+
+			data := <-dataChan
+			Expect(len(data)).To(BeNumerically("<=", syslogwriter.MaxUdpMessageSize))
+			var line map[string]string
+			Expect(json.Unmarshal(data, &line)).To(Succeed())
+			Expect(line["message"]).ToNot(BeEmpty())
+			Expect(message).To(HavePrefix(line["message"]))
+			close(done)
+		})
+	})
+
 	Context("With TLS Connection", func() {
 
 		var shutdownChan chan bool
@@ -92,7 +276,7 @@ var _ = Describe("SyslogWriter", func() {
 		})
 
 		It("should connect", func() {
-			w := syslogwriter.NewSyslogWriter("syslog-tls", "localhost:9999", "appId", true)
+			w := syslogwriter.NewSyslogWriter("syslog-tls", "localhost:9999", "appId", &syslogwriter.TLSConfig{Config: &tls.Config{InsecureSkipVerify: true}}, 0, nil, nil)
 			err := w.Connect()
 			Expect(err).To(BeNil())
 			_, err = w.WriteStdout([]byte("just a test"), "test", "", time.Now().UnixNano())
@@ -101,10 +285,30 @@ var _ = Describe("SyslogWriter", func() {
 		})
 
 		It("should reject self-signed certs", func() {
-			w := syslogwriter.NewSyslogWriter("syslog-tls", "localhost:9999", "appId", false)
+			w := syslogwriter.NewSyslogWriter("syslog-tls", "localhost:9999", "appId", nil, 0, nil, nil)
 			err := w.Connect()
 			Expect(err).ToNot(BeNil())
 		})
+
+		It("should accept drains with the pinned certificate fingerprint", func() {
+			certPEM, err := ioutil.ReadFile("cert.pem")
+			Expect(err).ToNot(HaveOccurred())
+			block, _ := pem.Decode(certPEM)
+			fingerprint := sha256.Sum256(block.Bytes)
+
+			tlsConfig := &syslogwriter.TLSConfig{Config: &tls.Config{InsecureSkipVerify: true}, Fingerprint: fingerprint[:]}
+			w := syslogwriter.NewSyslogWriter("syslog-tls", "localhost:9999", "appId", tlsConfig, 0, nil, nil)
+			defer w.Close()
+			Expect(w.Connect()).To(Succeed())
+		})
+
+		It("should reject drains with another certificate fingerprint", func() {
+			tlsConfig := &syslogwriter.TLSConfig{Config: &tls.Config{InsecureSkipVerify: true}, Fingerprint: make([]byte, 32)}
+			w := syslogwriter.NewSyslogWriter("syslog-tls", "localhost:9999", "appId", tlsConfig, 0, nil, nil)
+			err := w.Connect()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("does not match the pinned one"))
+		})
 	})
 })
 
@@ -145,6 +349,36 @@ func startSyslogServer(shutdownChan <-chan bool) (<-chan []byte, <-chan bool) {
 	return dataChan, doneChan
 }
 
+func startUdpSyslogServer(shutdownChan <-chan bool) (<-chan []byte, <-chan bool) {
+	dataChan := make(chan []byte)
+	doneChan := make(chan bool)
+	conn, err := net.ListenPacket("udp", "localhost:9999")
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		<-shutdownChan
+		conn.Close()
+		close(doneChan)
+	}()
+
+	go func() {
+		buffer := make([]byte, 65536)
+		readCount, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+
+		buffer2 := make([]byte, readCount)
+		copy(buffer2, buffer[:readCount])
+		dataChan <- buffer2
+	}()
+
+	<-time.After(300 * time.Millisecond)
+	return dataChan, doneChan
+}
+
 func startTLSSyslogServer(shutdownChan <-chan bool, logger *gosteno.Logger) <-chan bool {
 	doneChan := make(chan bool)
 	generateCert(logger)
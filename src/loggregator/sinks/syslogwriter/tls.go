@@ -0,0 +1,47 @@
+package syslogwriter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseFingerprint parses the SHA-256 fingerprint of a certificate given in
+// hex, optionally prefixed with sha256: and with its bytes separated by
+// colons as openssl x509 -fingerprint prints them.
+func ParseFingerprint(fingerprint string) ([]byte, error) {
+	hexFingerprint := strings.Replace(strings.TrimPrefix(strings.ToLower(fingerprint), "sha256:"), ":", "", -1)
+	sum, err := hex.DecodeString(hexFingerprint)
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("Invalid SHA-256 fingerprint: %s", fingerprint)
+	}
+	return sum, nil
+}
+
+// TLSConfig holds the TLS settings of a syslog-tls drain.
+type TLSConfig struct {
+	// Config is used for the handshake. Drains are verified against the
+	// system roots by their host name if it is nil.
+	Config *tls.Config
+	// Fingerprint, if set, is the SHA-256 fingerprint the drain certificate
+	// must have. Config should skip verifying the certificate chain then, so
+	// self-signed certificates can be pinned.
+	Fingerprint []byte
+}
+
+// verifyFingerprint checks that the drain presented a certificate with the
+// given SHA-256 fingerprint in the handshake of state.
+func verifyFingerprint(state tls.ConnectionState, fingerprint []byte) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("Drain presented no certificate")
+	}
+	sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+	if !bytes.Equal(sum[:], fingerprint) {
+		return fmt.Errorf("Drain certificate fingerprint %x does not match the pinned one", sum)
+	}
+	return nil
+}
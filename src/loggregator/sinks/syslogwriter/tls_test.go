@@ -0,0 +1,30 @@
+package syslogwriter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"loggregator/sinks/syslogwriter"
+	"strings"
+)
+
+var _ = Describe("ParseFingerprint", func() {
+	It("should parse hex fingerprints with and without colons and prefix", func() {
+		hexFingerprint := strings.Repeat("ab", 32)
+		colonFingerprint := "SHA256:" + strings.TrimSuffix(strings.Repeat("AB:", 32), ":")
+
+		for _, fingerprint := range []string{hexFingerprint, colonFingerprint} {
+			sum, err := syslogwriter.ParseFingerprint(fingerprint)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sum).To(HaveLen(32))
+			Expect(sum[0]).To(Equal(byte(0xab)))
+		}
+	})
+
+	It("should reject fingerprints that are not SHA-256 sums", func() {
+		_, err := syslogwriter.ParseFingerprint("abcd")
+		Expect(err).To(MatchError("Invalid SHA-256 fingerprint: abcd"))
+
+		_, err = syslogwriter.ParseFingerprint(strings.Repeat("zz", 32))
+		Expect(err).To(HaveOccurred())
+	})
+})
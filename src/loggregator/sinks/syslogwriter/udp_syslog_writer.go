@@ -0,0 +1,193 @@
+package syslogwriter
+
+import (
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"net"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Largest payload that fits into a single IPv4 UDP datagram.
+const MaxUdpMessageSize = 65507
+
+type udpWriter struct {
+	appId string
+	raddr string
+
+	connectedFlag
+
+	mu       sync.Mutex // guards conn and address
+	conn     net.Conn
+	address  string
+	resolver *Resolver
+
+	formatter Formatter
+
+	sentMessageCount      *uint64
+	sentByteCount         *uint64
+	truncatedMessageCount *uint64
+	writeErrorCount       *uint64
+}
+
+// NewUdpSyslogWriter returns a writer that sends every message as one
+// unframed datagram as described in https://tools.ietf.org/html/rfc5426
+// If resolver is not nil, datagrams go to the first of the addresses of the
+// drain host that did not fail. Messages are sent as RFC5424 unless a
+// formatter is given.
+func NewUdpSyslogWriter(raddr string, appId string, resolver *Resolver, formatter Formatter) *udpWriter {
+	return &udpWriter{
+		appId:                 appId,
+		raddr:                 raddr,
+		resolver:              resolver,
+		formatter:             formatter,
+		sentMessageCount:      new(uint64),
+		sentByteCount:         new(uint64),
+		truncatedMessageCount: new(uint64),
+		writeErrorCount:       new(uint64),
+	}
+}
+
+func (w *udpWriter) Connect() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.connect()
+	if err == nil {
+		w.SetConnected(true)
+	}
+	return err
+}
+
+// connect must be called with w.mu held.
+func (w *udpWriter) connect() error {
+	if w.conn != nil {
+		// ignore err from close, it makes sense to continue anyway
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	address := w.raddr
+	if w.resolver != nil {
+		addresses, err := w.resolver.Addresses()
+		if err != nil {
+			return err
+		}
+		address = addresses[0]
+	}
+
+	c, err := net.Dial("udp", address)
+	if err == nil {
+		w.conn = c
+		w.address = address
+	}
+	return err
+}
+
+func (w *udpWriter) WriteStdout(b []byte, source, sourceId string, timestamp int64) (int, error) {
+	return w.write(PriorityStdout, source, sourceId, string(b), timestamp)
+}
+
+func (w *udpWriter) WriteStderr(b []byte, source, sourceId string, timestamp int64) (int, error) {
+	return w.write(PriorityStderr, source, sourceId, string(b), timestamp)
+}
+
+func (w *udpWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn != nil {
+		err := w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (w *udpWriter) write(p int, source, sourceId, msg string, timestamp int64) (byte_count int, err error) {
+	format := w.formatter
+	if format == nil {
+		format = formatMessage
+	}
+	syslogMsg := format(p, w.appId, source, sourceId, msg, timestamp)
+	if len(syslogMsg) > MaxUdpMessageSize {
+		syslogMsg = truncateMessage(format, MaxUdpMessageSize, p, w.appId, source, sourceId, msg, timestamp)
+		atomic.AddUint64(w.truncatedMessageCount, 1)
+	}
+
+	return w.send([]byte(syslogMsg))
+}
+
+// send sends the datagrams of one message.
+func (w *udpWriter) send(datagrams ...[]byte) (byte_count int, err error) {
+	w.mu.Lock()
+	if w.conn != nil && w.resolver != nil && w.resolver.Stale() && !w.resolver.Resolves(w.address) {
+		// The drain host moved away from the address we are sending to.
+		err = w.connect()
+	}
+	for _, datagram := range datagrams {
+		if w.conn == nil || err != nil {
+			break
+		}
+		var n int
+		n, err = w.conn.Write(datagram)
+		byte_count += n
+		if err != nil && w.resolver != nil {
+			w.resolver.Failed(w.address)
+		}
+	}
+	w.mu.Unlock()
+
+	if err != nil {
+		atomic.AddUint64(w.writeErrorCount, 1)
+		return byte_count, err
+	}
+	atomic.AddUint64(w.sentMessageCount, 1)
+	atomic.AddUint64(w.sentByteCount, uint64(byte_count))
+	return byte_count, err
+}
+
+func (w *udpWriter) Emit() instrumentation.Context {
+	return instrumentation.Context{Name: "udpSyslogWriter",
+		Metrics: []instrumentation.Metric{
+			instrumentation.Metric{Name: "sentDatagramCount:" + w.appId, Value: atomic.LoadUint64(w.sentMessageCount)},
+			instrumentation.Metric{Name: "sentDatagramByteCount:" + w.appId, Value: atomic.LoadUint64(w.sentByteCount)},
+			instrumentation.Metric{Name: "truncatedMessageCount:" + w.appId, Value: atomic.LoadUint64(w.truncatedMessageCount)},
+			instrumentation.Metric{Name: "writeErrorCount:" + w.appId, Value: atomic.LoadUint64(w.writeErrorCount)},
+		},
+	}
+}
+
+// truncate cuts msg down to at most size bytes without splitting a
+// multi-byte UTF-8 sequence.
+func truncate(msg string, size int) string {
+	if len(msg) <= size {
+		return msg
+	}
+	for size > 0 && !utf8.RuneStart(msg[size]) {
+		size--
+	}
+	return msg[:size]
+}
+
+// truncateMessage cuts msg until format renders it into at most size bytes
+// and returns the rendered message. Cutting the message rather than the
+// rendered message keeps formats like JSON intact. Cutting as many bytes as
+// the rendered message is too long always makes it fit, but escaping may
+// make the rendered message much longer than msg, so a proportional cut is
+// tried first when it keeps more of msg.
+func truncateMessage(format Formatter, size int, p int, appId, source, sourceId, msg string, timestamp int64) string {
+	rendered := format(p, appId, source, sourceId, msg, timestamp)
+	for len(rendered) > size && len(msg) > 0 {
+		msgSize := len(msg) - (len(rendered) - size)
+		if proportional := int(int64(len(msg)) * int64(size) / int64(len(rendered))); proportional > msgSize {
+			msgSize = proportional
+		}
+		if msgSize < 0 {
+			msgSize = 0
+		}
+		msg = truncate(msg, msgSize)
+		rendered = format(p, appId, source, sourceId, msg, timestamp)
+	}
+	return truncate(rendered, size)
+}
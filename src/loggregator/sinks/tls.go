@@ -0,0 +1,98 @@
+package sinks
+
+import (
+	"crypto/tls"
+	"fmt"
+	"loggregator/sinks/syslogwriter"
+	"net"
+	"net/url"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+}
+
+// newTLSConfig returns the TLS settings of a syslog drain of the app. Drains
+// present the server wide client certificate and are verified against the
+// server wide CA bundle unless their URL picks others by name with
+// tls_client_cert and tls_ca, which the app has to be allowed to use. The
+// URL may also set tls_min_version, the tls_server_name to send and verify
+// instead of the drain host, and a tls_fingerprint to pin the drain
+// certificate to. Pinned drains are verified by their fingerprint only, so
+// self-signed certificates can be pinned.
+func newTLSConfig(appId string, parsedUrl *url.URL, config DrainConfig) (*syslogwriter.TLSConfig, error) {
+	query := parsedUrl.Query()
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.SkipCertVerify,
+		RootCAs:            config.RootCAs,
+		ServerName:         query.Get("tls_server_name"),
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = urlHost(parsedUrl)
+	}
+	if config.ClientCertificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*config.ClientCertificate}
+	}
+
+	if name := query.Get("tls_client_cert"); name != "" {
+		certificate, ok := config.ClientCertificates[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown tls_client_cert: %s", name)
+		}
+		if !isAllowed(appId, certificate.AppIds) {
+			return nil, fmt.Errorf("tls_client_cert %s is not allowed for app %s", name, appId)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate.Certificate}
+	}
+
+	if name := query.Get("tls_ca"); name != "" {
+		bundle, ok := config.CABundles[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown tls_ca: %s", name)
+		}
+		if !isAllowed(appId, bundle.AppIds) {
+			return nil, fmt.Errorf("tls_ca %s is not allowed for app %s", name, appId)
+		}
+		tlsConfig.RootCAs = bundle.RootCAs
+	}
+
+	if value := query.Get("tls_min_version"); value != "" {
+		version, ok := tlsVersions[value]
+		if !ok {
+			return nil, fmt.Errorf("Invalid tls_min_version: %s", value)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	var fingerprint []byte
+	if value := query.Get("tls_fingerprint"); value != "" {
+		var err error
+		fingerprint, err = syslogwriter.ParseFingerprint(value)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return &syslogwriter.TLSConfig{Config: tlsConfig, Fingerprint: fingerprint}, nil
+}
+
+// urlHost returns the host of parsedUrl without the port.
+func urlHost(parsedUrl *url.URL) string {
+	host, _, err := net.SplitHostPort(parsedUrl.Host)
+	if err != nil {
+		return parsedUrl.Host
+	}
+	return host
+}
+
+func isAllowed(appId string, appIds []string) bool {
+	for _, allowed := range appIds {
+		if allowed == appId {
+			return true
+		}
+	}
+	return false
+}
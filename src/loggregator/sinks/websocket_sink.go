@@ -5,25 +5,30 @@ import (
 	"github.com/cloudfoundry/gosteno"
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"loggregator/buffer/truncatingbuffer"
+	"loggregator/dropcounter"
 	"net"
 	"sync/atomic"
 	"time"
 )
 
 type WebsocketSink struct {
-	logger              *gosteno.Logger
-	appId               string
-	ws                  *websocket.Conn
-	clientAddress       net.Addr
-	sentMessageCount    *uint64
-	sentByteCount       *uint64
-	keepAliveInterval   time.Duration
-	listenerChannel     chan *logmessage.Message
-	sinkCloseChan       chan Sink
-	wsMessageBufferSize uint
+	logger                    *gosteno.Logger
+	appId                     string
+	ws                        *websocket.Conn
+	clientAddress             net.Addr
+	sentMessageCount          *uint64
+	sentByteCount             *uint64
+	bufferDroppedMessageCount *uint64
+	keepAliveInterval         time.Duration
+	listenerChannel           chan *logmessage.Message
+	sinkCloseChan             chan Sink
+	wsMessageBufferSize       uint
+	overflowPolicy            truncatingbuffer.Policy
+	appDroppedMessages        *dropcounter.Counter
 }
 
-func NewWebsocketSink(appId string, givenLogger *gosteno.Logger, ws *websocket.Conn, clientAddress net.Addr, sinkCloseChan chan Sink, keepAliveInterval time.Duration, wsMessageBufferSize uint) Sink {
+func NewWebsocketSink(appId string, givenLogger *gosteno.Logger, ws *websocket.Conn, clientAddress net.Addr, sinkCloseChan chan Sink, keepAliveInterval time.Duration, wsMessageBufferSize uint, overflowPolicy truncatingbuffer.Policy, appDroppedMessages *dropcounter.Counter) Sink {
 	return &WebsocketSink{
 		givenLogger,
 		appId,
@@ -31,10 +36,13 @@ func NewWebsocketSink(appId string, givenLogger *gosteno.Logger, ws *websocket.C
 		clientAddress,
 		new(uint64),
 		new(uint64),
+		new(uint64),
 		keepAliveInterval,
 		make(chan *logmessage.Message),
 		sinkCloseChan,
 		wsMessageBufferSize,
+		overflowPolicy,
+		appDroppedMessages,
 	}
 }
 
@@ -93,7 +101,7 @@ func (sink *WebsocketSink) Run() {
 	keepAliveFailure := sink.keepAliveFailureChannel()
 	alreadyRequestedClose := false
 
-	buffer := runTruncatingBuffer(sink, sink.wsMessageBufferSize, sink.Logger())
+	buffer := runTruncatingBuffer(sink, sink.wsMessageBufferSize, sink.overflowPolicy, sink.bufferDroppedMessageCount, sink.appDroppedMessages, sink.Logger())
 	for {
 		sink.logger.Debugf("Websocket Sink %s: Waiting for activity", sink.clientAddress)
 		select {
@@ -127,6 +135,7 @@ func (sink *WebsocketSink) Emit() instrumentation.Context {
 		Metrics: []instrumentation.Metric{
 			instrumentation.Metric{Name: "sentMessageCount:" + sink.appId, Value: atomic.LoadUint64(sink.sentMessageCount)},
 			instrumentation.Metric{Name: "sentByteCount:" + sink.appId, Value: atomic.LoadUint64(sink.sentByteCount)},
+			bufferDroppedMessageCountMetric(sink.overflowPolicy, sink.appId, sink.bufferDroppedMessageCount),
 		},
 	}
 }
@@ -0,0 +1,84 @@
+package sinkserver
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/cloudfoundry/gosteno"
+	"net/http"
+	"strings"
+)
+
+const DRAIN_STATUS_PATH = "/drains"
+
+type drainStatusServer struct {
+	apiEndpoint string
+	sinkManager *SinkManager
+	username    string
+	password    string
+	logger      *gosteno.Logger
+}
+
+// NewDrainStatusServer creates a server reporting the status of drains as
+// JSON. Requests have to use basic auth with the given credentials and may
+// be limited to a single app with the app query parameter.
+func NewDrainStatusServer(apiEndpoint string, sinkManager *SinkManager, username, password string, logger *gosteno.Logger) *drainStatusServer {
+	return &drainStatusServer{
+		apiEndpoint: apiEndpoint,
+		sinkManager: sinkManager,
+		username:    username,
+		password:    password,
+		logger:      logger,
+	}
+}
+
+func (drainStatusServer *drainStatusServer) Start() {
+	drainStatusServer.logger.Infof("DrainStatusServer: Listening for status requests at %s", drainStatusServer.apiEndpoint)
+	mux := http.NewServeMux()
+	mux.Handle(DRAIN_STATUS_PATH, drainStatusServer)
+	if err := http.ListenAndServe(drainStatusServer.apiEndpoint, mux); err != nil {
+		panic(err)
+	}
+}
+
+func (drainStatusServer *drainStatusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !drainStatusServer.authenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="loggregator"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses := drainStatusServer.sinkManager.DrainStatuses(r.URL.Query().Get("app"))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		drainStatusServer.logger.Warnf("DrainStatusServer: Error writing response. Err: %v", err)
+	}
+}
+
+func (drainStatusServer *drainStatusServer) authenticated(r *http.Request) bool {
+	if drainStatusServer.username == "" {
+		return false
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Basic ") {
+		return false
+	}
+	credentials, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "Basic "))
+	if err != nil {
+		return false
+	}
+	username, password := string(credentials), ""
+	if i := strings.Index(username, ":"); i >= 0 {
+		username, password = username[:i], username[i+1:]
+	}
+
+	usernameMatches := subtle.ConstantTimeCompare([]byte(username), []byte(drainStatusServer.username)) == 1
+	passwordMatches := subtle.ConstantTimeCompare([]byte(password), []byte(drainStatusServer.password)) == 1
+	return usernameMatches && passwordMatches
+}
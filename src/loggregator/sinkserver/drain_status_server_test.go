@@ -0,0 +1,106 @@
+package sinkserver_test
+
+import (
+	"encoding/json"
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"github.com/cloudfoundry/loggregatorlib/loggertesthelper"
+	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"loggregator/iprange"
+	"loggregator/sinks"
+	"loggregator/sinkserver"
+	"net/http"
+	"net/http/httptest"
+)
+
+type StatusDrain struct {
+	ChannelSink
+	status sinks.DrainStatus
+}
+
+func (d *StatusDrain) Disconnect()               {}
+func (d *StatusDrain) DrainType() string         { return d.status.DrainType }
+func (d *StatusDrain) IsConnected() bool         { return d.status.Connected }
+func (d *StatusDrain) Status() sinks.DrainStatus { return d.status }
+
+func newStatusDrain(appId, drainUrl string, connected bool, consecutiveFailures int) *StatusDrain {
+	return &StatusDrain{
+		ChannelSink: ChannelSink{appId: appId, identifier: drainUrl, logger: loggertesthelper.Logger(), channel: make(chan *logmessage.Message)},
+		status: sinks.DrainStatus{
+			AppId:                 appId,
+			DrainUrl:              drainUrl,
+			DrainType:             "syslog",
+			Connected:             connected,
+			ConsecutiveFailures:   consecutiveFailures,
+			CurrentBackoffSeconds: float64(consecutiveFailures),
+			SentMessages:          10,
+			DroppedMessages:       2,
+		},
+	}
+}
+
+var _ = Describe("DrainStatusServer", func() {
+	var sinkManager *sinkserver.SinkManager
+	var server http.Handler
+
+	get := func(path, username, password string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", path, nil)
+		if username != "" {
+			request.SetBasicAuth(username, password)
+		}
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	statusesFrom := func(recorder *httptest.ResponseRecorder) []sinks.DrainStatus {
+		var statuses []sinks.DrainStatus
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &statuses)).To(Succeed())
+		return statuses
+	}
+
+	BeforeEach(func() {
+		sinkManager = sinkserver.NewSinkManager(1, 0, 0, sinks.DrainConfig{}, []iprange.IPRange{}, loggertesthelper.Logger())
+		server = sinkserver.NewDrainStatusServer("localhost:0", sinkManager, "user", "pass", loggertesthelper.Logger())
+
+		sinkManager.RegisterSink(newStatusDrain("app1", "syslog://host1:514", true, 0))
+		sinkManager.RegisterSink(newStatusDrain("app2", "syslog://host2:514", false, 3))
+	})
+
+	It("rejects requests without credentials", func() {
+		recorder := get("/drains", "", "")
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		Expect(recorder.Header().Get("WWW-Authenticate")).To(ContainSubstring("Basic"))
+	})
+
+	It("rejects requests with the wrong credentials", func() {
+		recorder := get("/drains", "user", "wrong")
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("returns the status of all drains", func() {
+		recorder := get("/drains", "user", "pass")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(statusesFrom(recorder)).To(HaveLen(2))
+	})
+
+	It("filters by app id", func() {
+		statuses := statusesFrom(get("/drains?app=app2", "user", "pass"))
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].AppId).To(Equal("app2"))
+		Expect(statuses[0].DrainUrl).To(Equal("syslog://host2:514"))
+		Expect(statuses[0].ConsecutiveFailures).To(Equal(3))
+	})
+
+	It("adds aggregate drain gauges to the sink manager metrics", func() {
+		metrics := sinkManager.Emit().Metrics
+		Expect(metrics).To(ContainElement(instrumentation.Metric{Name: "numberOfConnectedDrains", Value: 1}))
+		Expect(metrics).To(ContainElement(instrumentation.Metric{Name: "numberOfFailingDrains", Value: 1}))
+		Expect(metrics).To(ContainElement(instrumentation.Metric{Name: "numberOfBackingOffDrains", Value: 1}))
+		Expect(metrics).To(ContainElement(instrumentation.Metric{Name: "numberOfOpenDrainCircuits", Value: 0}))
+		Expect(metrics).To(ContainElement(instrumentation.Metric{Name: "drainSentMessageCount", Value: uint64(20)}))
+		Expect(metrics).To(ContainElement(instrumentation.Metric{Name: "drainDroppedMessageCount", Value: uint64(4)}))
+	})
+})
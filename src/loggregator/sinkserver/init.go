@@ -5,7 +5,9 @@ import (
 	"encoding/binary"
 	"github.com/cloudfoundry/loggregatorlib/loggertesthelper"
 	"github.com/stretchr/testify/assert"
+	"loggregator/buffer/truncatingbuffer"
 	"loggregator/iprange"
+	"loggregator/sinks"
 	testhelpers "server_testhelpers"
 	"testing"
 	"time"
@@ -33,25 +35,25 @@ func init() {
 
 	logger := loggertesthelper.Logger()
 
-	sinkManager = NewSinkManager(1024, false, nil, logger)
+	sinkManager = NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
 	go sinkManager.Start()
 
-	TestMessageRouter = NewMessageRouter(dataReadChannel, testhelpers.UnmarshallerMaker(SECRET), sinkManager, 2048, logger)
+	TestMessageRouter = NewMessageRouter(dataReadChannel, testhelpers.UnmarshallerMaker(SECRET), sinkManager, nil, 2048, logger)
 	go TestMessageRouter.Start()
 
 	apiEndpoint := "localhost:" + SERVER_PORT
-	TestWebsocketServer = NewWebsocketServer(apiEndpoint, sinkManager, 10*time.Millisecond, 100, loggertesthelper.Logger())
+	TestWebsocketServer = NewWebsocketServer(apiEndpoint, sinkManager, 10*time.Millisecond, 100, truncatingbuffer.Policy{}, loggertesthelper.Logger())
 	go TestWebsocketServer.Start()
 
 	blackListDataReadChannel = make(chan []byte)
-	blacklistSinkManager := NewSinkManager(1024, false, []iprange.IPRange{iprange.IPRange{Start: "127.0.0.0", End: "127.0.0.2"}}, logger)
+	blacklistSinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, []iprange.IPRange{iprange.IPRange{Start: "127.0.0.0", End: "127.0.0.2"}}, logger)
 	go blacklistSinkManager.Start()
 
-	blacklistTestMessageRouter := NewMessageRouter(blackListDataReadChannel, testhelpers.UnmarshallerMaker(SECRET), blacklistSinkManager, 2048, logger)
+	blacklistTestMessageRouter := NewMessageRouter(blackListDataReadChannel, testhelpers.UnmarshallerMaker(SECRET), blacklistSinkManager, nil, 2048, logger)
 	go blacklistTestMessageRouter.Start()
 
 	blacklistApiEndpoint := "localhost:" + BLACKLIST_SERVER_PORT
-	blackListTestWebsocketServer = NewWebsocketServer(blacklistApiEndpoint, blacklistSinkManager, 10*time.Millisecond, 100, loggertesthelper.Logger())
+	blackListTestWebsocketServer = NewWebsocketServer(blacklistApiEndpoint, blacklistSinkManager, 10*time.Millisecond, 100, truncatingbuffer.Policy{}, loggertesthelper.Logger())
 	go blackListTestWebsocketServer.Start()
 
 	time.Sleep(2 * time.Millisecond)
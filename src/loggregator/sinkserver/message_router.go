@@ -1,9 +1,22 @@
 package sinkserver
 
 import (
+	"fmt"
 	"github.com/cloudfoundry/gosteno"
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"loggregator/dropcounter"
+	"loggregator/redaction"
+	"time"
+)
+
+const (
+	// The number of apps with the most dropped messages reported in varz.
+	topDropOffenders = 10
+
+	// Apps are told how many of their messages were dropped at most this
+	// often.
+	dropNoticeInterval = 30 * time.Second
 )
 
 type messageRouter struct {
@@ -11,30 +24,85 @@ type messageRouter struct {
 	unmarshaller    func([]byte) (*logmessage.Message, error)
 	outgoingLogChan chan *logmessage.Message
 	SinkManager     *SinkManager
+	redactor        *redaction.Redactor
 	Metrics         *MessageRouterMetrics
-	logger          *gosteno.Logger
+	// DroppedMessages counts the messages dropped per app because the
+	// router could not keep up.
+	DroppedMessages    *dropcounter.Counter
+	dropNoticeInterval time.Duration
+	logger             *gosteno.Logger
 }
 
-func NewMessageRouter(incomingLogChan chan []byte, unmarshaller func([]byte) (*logmessage.Message, error), sinkManager *SinkManager, messageChannelLength int, logger *gosteno.Logger) *messageRouter {
+func NewMessageRouter(incomingLogChan chan []byte, unmarshaller func([]byte) (*logmessage.Message, error), sinkManager *SinkManager, redactor *redaction.Redactor, messageChannelLength int, logger *gosteno.Logger) *messageRouter {
 	return &messageRouter{
-		incomingLogChan: incomingLogChan,
-		unmarshaller:    unmarshaller,
-		outgoingLogChan: make(chan *logmessage.Message, messageChannelLength),
-		SinkManager:     sinkManager,
-		Metrics:         &MessageRouterMetrics{},
-		logger:          logger,
+		incomingLogChan:    incomingLogChan,
+		unmarshaller:       unmarshaller,
+		outgoingLogChan:    make(chan *logmessage.Message, messageChannelLength),
+		SinkManager:        sinkManager,
+		redactor:           redactor,
+		Metrics:            &MessageRouterMetrics{},
+		DroppedMessages:    sinkManager.NewAppDropCounter("messageRouterDrops"),
+		dropNoticeInterval: dropNoticeInterval,
+		logger:             logger,
 	}
 }
 
 func (messageRouter *messageRouter) Start() {
 	go messageRouter.listenForLogs()
 
-	for message := range messageRouter.outgoingLogChan {
-		messageRouter.logger.Debugf("MessageRouter:outgoingLogChan: Received %d bytes of data from agent listener.", message.GetRawMessageLength())
+	dropNotices := time.NewTicker(messageRouter.dropNoticeInterval)
+	defer dropNotices.Stop()
+
+	for {
+		select {
+		case message, ok := <-messageRouter.outgoingLogChan:
+			if !ok {
+				return
+			}
+			messageRouter.route(message)
+		case <-dropNotices.C:
+			messageRouter.sendDropNotices()
+		}
+	}
+}
+
+func (messageRouter *messageRouter) route(message *logmessage.Message) {
+	messageRouter.logger.Debugf("MessageRouter:outgoingLogChan: Received %d bytes of data from agent listener.", message.GetRawMessageLength())
+
+	message, err := messageRouter.redactor.Redact(message)
+	if err != nil {
+		messageRouter.logger.Errorf("MessageRouter:outgoingLogChan: Redacted log message could not be marshalled. Dropping it... Error: %v", err)
+		return
+	}
 
-		messageRouter.manageSinks(message)
+	messageRouter.manageSinks(message)
 
-		messageRouter.send(message)
+	messageRouter.send(message)
+}
+
+// sendDropNotices tells every app that lost messages in the router or in
+// the buffers of its sinks since the last notice how many, so developers
+// know their logs are incomplete. Notices that do not fit into the error
+// channel are counted and dropped rather than holding up the router.
+func (messageRouter *messageRouter) sendDropNotices() {
+	dropped := messageRouter.DroppedMessages.TakePending()
+	for appId, count := range messageRouter.SinkManager.BufferDroppedMessages.TakePending() {
+		dropped[appId] += count
+	}
+
+	for appId, count := range dropped {
+		errorMsg := fmt.Sprintf("Loggregator dropped %d messages of this app in the last %v because it could not keep up. Logs are incomplete.", count, messageRouter.dropNoticeInterval)
+		logMessage, err := logmessage.GenerateMessage(logmessage.LogMessage_ERR, errorMsg, appId, "LGR")
+		if err != nil {
+			messageRouter.logger.Warnf("Error marshalling message: %v", err)
+			continue
+		}
+		select {
+		case messageRouter.SinkManager.errorChannel <- logMessage:
+		default:
+			messageRouter.Metrics.UndeliveredDropNotices++
+			messageRouter.logger.Debugf("MessageRouter:sendDropNotices(): errorChannel full -- dropping notice for [%s]", appId)
+		}
 	}
 }
 
@@ -57,6 +125,7 @@ func (messageRouter *messageRouter) listenForLogs() {
 		case messageRouter.outgoingLogChan <- message:
 		default:
 			messageRouter.Metrics.DroppedInParseEnvelopes++
+			messageRouter.DroppedMessages.Add(message.GetLogMessage().GetAppId(), 1)
 			messageRouter.logger.Debug("MessageRouter:listenForLogs(): incomingLogChan full -- dropping message")
 		}
 	}
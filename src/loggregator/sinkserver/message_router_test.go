@@ -1,6 +1,7 @@
 package sinkserver
 
 import (
+	"errors"
 	"fmt"
 	"github.com/cloudfoundry/gosteno"
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
@@ -9,6 +10,9 @@ import (
 	messagetesthelpers "github.com/cloudfoundry/loggregatorlib/logmessage/testhelpers"
 	"github.com/stretchr/testify/assert"
 	"loggregator/iprange"
+	"loggregator/redaction"
+	"loggregator/sinks"
+	"net/url"
 	"runtime"
 	testhelpers "server_testhelpers"
 	"testing"
@@ -50,11 +54,11 @@ func (ts testSink) Logger() *gosteno.Logger {
 
 func TestErrorMessagesAreDeliveredToSinksThatSupportThem(t *testing.T) {
 	logger := loggertesthelper.Logger()
-	sinkManager := NewSinkManager(1024, false, nil, logger)
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
 	go sinkManager.Start()
 
 	incomingLogChan := make(chan []byte, 10)
-	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, 2048, logger)
+	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
 	go testMessageRouter.Start()
 
 	ourSink := testSink{make(chan *logmessage.Message, 100), true}
@@ -69,13 +73,84 @@ func TestErrorMessagesAreDeliveredToSinksThatSupportThem(t *testing.T) {
 	}
 }
 
+func TestDropNoticesAreDeliveredToTheApp(t *testing.T) {
+	logger := loggertesthelper.Logger()
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
+	go sinkManager.Start()
+
+	incomingLogChan := make(chan []byte, 10)
+	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
+	testMessageRouter.dropNoticeInterval = 10 * time.Millisecond
+	go testMessageRouter.Start()
+
+	ourSink := testSink{make(chan *logmessage.Message, 100), true}
+	sinkManager.sinkOpenChan <- ourSink
+	<-time.After(1 * time.Millisecond)
+
+	testMessageRouter.DroppedMessages.Add("appId", 2)
+	sinkManager.BufferDroppedMessages.Add("appId", 3)
+	select {
+	case notice := <-ourSink.Channel():
+		assert.Equal(t, string(notice.GetLogMessage().GetMessage()), "Loggregator dropped 5 messages of this app in the last 10ms because it could not keep up. Logs are incomplete.")
+		assert.Equal(t, notice.GetLogMessage().GetSourceName(), "LGR")
+	case <-time.After(100 * time.Millisecond):
+		t.Error("Should have received a drop notice")
+	}
+
+	select {
+	case <-ourSink.Channel():
+		t.Error("Should not have received another drop notice")
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func TestDropNoticesDoNotBlockWhenTheErrorChannelIsFull(t *testing.T) {
+	logger := loggertesthelper.Logger()
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
+	for i := 0; i < cap(sinkManager.errorChannel); i++ {
+		sinkManager.errorChannel <- messagetesthelpers.NewMessage(t, "error msg", "appId")
+	}
+
+	testMessageRouter := NewMessageRouter(make(chan []byte), testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
+	testMessageRouter.DroppedMessages.Add("appId", 2)
+	testMessageRouter.DroppedMessages.Add("otherAppId", 3)
+
+	sent := make(chan bool)
+	go func() {
+		testMessageRouter.sendDropNotices()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Sending drop notices blocked on the full error channel")
+	}
+	assert.Equal(t, testMessageRouter.Metrics.UndeliveredDropNotices, uint(2))
+}
+
+func TestDropCountsAreForgottenOnceTheLastSinkOfTheAppIsGone(t *testing.T) {
+	logger := loggertesthelper.Logger()
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
+	testMessageRouter := NewMessageRouter(make(chan []byte), testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
+
+	ourSink := testSink{make(chan *logmessage.Message, 100), true}
+	sinkManager.RegisterSink(ourSink)
+	testMessageRouter.DroppedMessages.Add("appId", 2)
+	sinkManager.BufferDroppedMessages.Add("appId", 3)
+	sinkManager.UnregisterSink(ourSink)
+
+	assert.Equal(t, testMessageRouter.DroppedMessages.Count("appId"), uint64(0))
+	assert.Equal(t, sinkManager.BufferDroppedMessages.Count("appId"), uint64(0))
+	assert.Equal(t, testMessageRouter.DroppedMessages.Total(), uint64(2))
+}
+
 func TestErrorMessagesAreNotDeliveredToSinksThatDontAcceptErrors(t *testing.T) {
 	logger := loggertesthelper.Logger()
-	sinkManager := NewSinkManager(1024, false, nil, logger)
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
 	go sinkManager.Start()
 
 	incomingLogChan := make(chan []byte, 10)
-	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, 2048, logger)
+	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
 	go testMessageRouter.Start()
 
 	ourSink := testSink{make(chan *logmessage.Message, 100), false}
@@ -92,12 +167,12 @@ func TestErrorMessagesAreNotDeliveredToSinksThatDontAcceptErrors(t *testing.T) {
 
 func TestSendingToErrorChannelDoesNotBlock(t *testing.T) {
 	logger := loggertesthelper.Logger()
-	sinkManager := NewSinkManager(1024, false, nil, logger)
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
 	sinkManager.errorChannel = make(chan *logmessage.Message, 1)
 	go sinkManager.Start()
 
 	incomingLogChan := make(chan []byte, 10)
-	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, 2048, logger)
+	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
 	go testMessageRouter.Start()
 
 	sinkChannel := make(chan *logmessage.Message, 10)
@@ -122,14 +197,43 @@ func TestSendingToErrorChannelDoesNotBlock(t *testing.T) {
 	}
 }
 
+func TestMessagesAreRedactedBeforeFanOut(t *testing.T) {
+	logger := loggertesthelper.Logger()
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
+	go sinkManager.Start()
+
+	redactor, err := redaction.NewRedactor([]redaction.Rule{{Name: "password", Pattern: `(password=)\S+`, Replacement: "${1}[REDACTED]"}})
+	assert.NoError(t, err)
+
+	incomingLogChan := make(chan []byte, 10)
+	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, redactor, 2048, logger)
+	go testMessageRouter.Start()
+
+	ourSink := testSink{make(chan *logmessage.Message, 100), false}
+	sinkManager.sinkOpenChan <- ourSink
+	<-time.After(1 * time.Millisecond)
+
+	testMessageRouter.outgoingLogChan <- messagetesthelpers.NewMessage(t, "login password=hunter2 ok", "appId")
+
+	select {
+	case message := <-ourSink.Channel():
+		assert.Equal(t, string(message.GetLogMessage().GetMessage()), "login password=[REDACTED] ok")
+		messagetesthelpers.AssertProtoBufferMessageEquals(t, "login password=[REDACTED] ok", message.GetRawMessage())
+	case <-time.After(100 * time.Millisecond):
+		t.Error("Should have received a message")
+	}
+
+	assert.Equal(t, redactor.Emit().Metrics[0], instrumentation.Metric{Name: "redactionCount:password", Value: uint64(1)})
+}
+
 func TestThatItDoesNotCreateAnotherSyslogDrainIfItIsAlreadyThere(t *testing.T) {
 	logger := loggertesthelper.Logger()
-	sinkManager := NewSinkManager(1024, false, nil, logger)
-	oldActiveSyslogSinksCounter := sinkManager.Metrics.SyslogSinks
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
+	oldActiveSyslogSinksCounter := sinkManager.Metrics.DrainSinks("syslog")
 	go sinkManager.Start()
 
 	incomingLogChan := make(chan []byte, 10)
-	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, 2048, logger)
+	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
 
 	go testMessageRouter.Start()
 	ourSink := testSink{make(chan *logmessage.Message, 100), false}
@@ -141,22 +245,45 @@ func TestThatItDoesNotCreateAnotherSyslogDrainIfItIsAlreadyThere(t *testing.T) {
 	testMessageRouter.outgoingLogChan <- message
 	waitForMessageGettingProcessed(t, ourSink, 10*time.Millisecond)
 
-	assert.Equal(t, sinkManager.Metrics.SyslogSinks, oldActiveSyslogSinksCounter+1)
+	assert.Equal(t, sinkManager.Metrics.DrainSinks("syslog"), oldActiveSyslogSinksCounter+1)
+
+	testMessageRouter.outgoingLogChan <- message
+	waitForMessageGettingProcessed(t, ourSink, 10*time.Millisecond)
+
+	assert.Equal(t, sinkManager.Metrics.DrainSinks("syslog"), oldActiveSyslogSinksCounter+1)
+}
+
+func TestDrainUrlsWithDifferentFiltersAreDistinctDrains(t *testing.T) {
+	logger := loggertesthelper.Logger()
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
+	oldActiveSyslogSinksCounter := sinkManager.Metrics.DrainSinks("syslog")
+	go sinkManager.Start()
+
+	incomingLogChan := make(chan []byte, 10)
+	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
+
+	go testMessageRouter.Start()
+	ourSink := testSink{make(chan *logmessage.Message, 100), false}
+	sinkManager.sinkOpenChan <- ourSink
+	<-time.After(1 * time.Millisecond)
 
+	message := messagetesthelpers.NewMessage(t, "error msg", "appId")
+	message.GetLogMessage().DrainUrls = []string{"syslog://10.10.123.1:514?types=err", "syslog://10.10.123.1:514?types=out&exclude_sources=STG"}
 	testMessageRouter.outgoingLogChan <- message
 	waitForMessageGettingProcessed(t, ourSink, 10*time.Millisecond)
 
-	assert.Equal(t, sinkManager.Metrics.SyslogSinks, oldActiveSyslogSinksCounter+1)
+	assert.Equal(t, sinkManager.Metrics.DrainSinks("syslog"), oldActiveSyslogSinksCounter+2)
+	assert.Equal(t, len(sinkManager.sinks.DrainsFor("appId")), 2)
 }
 
 func TestSimpleBlacklistRule(t *testing.T) {
 	logger := loggertesthelper.Logger()
-	sinkManager := NewSinkManager(1024, false, []iprange.IPRange{iprange.IPRange{Start: "10.10.123.1", End: "10.10.123.1"}}, logger)
-	oldActiveSyslogSinksCounter := sinkManager.Metrics.SyslogSinks
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, []iprange.IPRange{iprange.IPRange{Start: "10.10.123.1", End: "10.10.123.1"}}, logger)
+	oldActiveSyslogSinksCounter := sinkManager.Metrics.DrainSinks("syslog")
 	go sinkManager.Start()
 
 	incomingLogChan := make(chan []byte, 10)
-	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, 2048, logger)
+	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
 	go testMessageRouter.Start()
 
 	ourSink := testSink{make(chan *logmessage.Message, 100), true}
@@ -193,24 +320,24 @@ func TestSimpleBlacklistRule(t *testing.T) {
 	case <-time.After(100 * time.Millisecond):
 	}
 
-	assert.Equal(t, sinkManager.Metrics.SyslogSinks, oldActiveSyslogSinksCounter)
+	assert.Equal(t, sinkManager.Metrics.DrainSinks("syslog"), oldActiveSyslogSinksCounter)
 
 	message = messagetesthelpers.NewMessage(t, "error msg", "appId")
 	message.GetLogMessage().DrainUrls = []string{"http://10.10.123.2"}
 	testMessageRouter.outgoingLogChan <- message
 	waitForMessageGettingProcessed(t, ourSink, 10*time.Millisecond)
 
-	assert.Equal(t, sinkManager.Metrics.SyslogSinks, oldActiveSyslogSinksCounter+1)
+	assert.Equal(t, sinkManager.Metrics.DrainSinks("syslog"), oldActiveSyslogSinksCounter+1)
 }
 
 func TestInvalidUrlForSyslogDrain(t *testing.T) {
 	logger := loggertesthelper.Logger()
-	sinkManager := NewSinkManager(1024, false, []iprange.IPRange{iprange.IPRange{Start: "10.10.123.1", End: "10.10.123.1"}}, logger)
-	oldActiveSyslogSinksCounter := sinkManager.Metrics.SyslogSinks
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, []iprange.IPRange{iprange.IPRange{Start: "10.10.123.1", End: "10.10.123.1"}}, logger)
+	oldActiveSyslogSinksCounter := sinkManager.Metrics.DrainSinks("syslog")
 	go sinkManager.Start()
 
 	incomingLogChan := make(chan []byte, 10)
-	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, 2048, logger)
+	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
 	go testMessageRouter.Start()
 
 	ourSink := testSink{make(chan *logmessage.Message, 100), true}
@@ -247,16 +374,53 @@ func TestInvalidUrlForSyslogDrain(t *testing.T) {
 	case <-time.After(100 * time.Millisecond):
 	}
 
-	assert.Equal(t, sinkManager.Metrics.SyslogSinks, oldActiveSyslogSinksCounter)
+	assert.Equal(t, sinkManager.Metrics.DrainSinks("syslog"), oldActiveSyslogSinksCounter)
+}
+
+func TestDrainFactoryErrorIsReportedAndUrlIsBlacklisted(t *testing.T) {
+	logger := loggertesthelper.Logger()
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, nil, logger)
+	sinkManager.RegisterDrainFactory("broken", func(appId string, drainUrl string, parsedUrl *url.URL, config sinks.DrainConfig, logger *gosteno.Logger, errorChannel chan<- *logmessage.Message) (sinks.Drain, error) {
+		return nil, errors.New("broken drain")
+	})
+	go sinkManager.Start()
+
+	incomingLogChan := make(chan []byte, 10)
+	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
+	go testMessageRouter.Start()
+
+	ourSink := testSink{make(chan *logmessage.Message, 100), true}
+	sinkManager.sinkOpenChan <- ourSink
+	<-time.After(1 * time.Millisecond)
+
+	message := messagetesthelpers.NewMessage(t, "error msg", "appId")
+	message.GetLogMessage().DrainUrls = []string{"broken://10.10.123.1"}
+	testMessageRouter.outgoingLogChan <- message
+
+	select {
+	case _ = <-ourSink.Channel():
+	case <-time.After(100 * time.Millisecond):
+		t.Error("Did not receive real message")
+	}
+
+	select {
+	case errorMessage := <-ourSink.Channel():
+		assert.Contains(t, string(errorMessage.GetLogMessage().GetMessage()), "Unable to create drain for URL: broken://10.10.123.1. Err: broken drain")
+	case <-time.After(100 * time.Millisecond):
+		t.Error("Did not receive message about the broken drain")
+	}
+
+	assert.True(t, sinkManager.urlBlacklistManager.IsBlacklisted("broken://10.10.123.1"))
+	assert.Equal(t, sinkManager.Metrics.DrainSinks("broken"), 0)
 }
 
 func TestStopsRetryingWhenSinkIsUnregistered(t *testing.T) {
 	logger := loggertesthelper.Logger()
-	sinkManager := NewSinkManager(1024, false, []iprange.IPRange{iprange.IPRange{Start: "10.10.123.1", End: "10.10.123.1"}}, logger)
+	sinkManager := NewSinkManager(1024, 0, 0, sinks.DrainConfig{}, []iprange.IPRange{iprange.IPRange{Start: "10.10.123.1", End: "10.10.123.1"}}, logger)
 	go sinkManager.Start()
 
 	incomingLogChan := make(chan []byte, 10)
-	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, 2048, logger)
+	testMessageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, 2048, logger)
 	go testMessageRouter.Start()
 
 	ourSink := testSink{make(chan *logmessage.Message, 100), true}
@@ -300,10 +464,10 @@ func TestParseEnvelopesDoesntBlockWhenMessageRouterChannelIsFull(t *testing.T) {
 	logger := gosteno.NewLogger("TestLogger")
 
 	messageChannelLength := 1
-	sinkManager := NewSinkManager(1, true, []iprange.IPRange{}, logger)
+	sinkManager := NewSinkManager(1, 0, 0, sinks.DrainConfig{SkipCertVerify: true}, []iprange.IPRange{}, logger)
 	go sinkManager.Start()
 	incomingLogChan := make(chan []byte, 1)
-	messageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, messageChannelLength, logger)
+	messageRouter := NewMessageRouter(incomingLogChan, testhelpers.UnmarshallerMaker("secret"), sinkManager, nil, messageChannelLength, logger)
 	go messageRouter.listenForLogs()
 
 	testMessage := messagetesthelpers.MarshalledLogEnvelopeForMessage(t, "msg", "appName", "secret")
@@ -316,4 +480,7 @@ func TestParseEnvelopesDoesntBlockWhenMessageRouterChannelIsFull(t *testing.T) {
 			t.Fatal("Shouldn't have blocked")
 		}
 	}
+
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, messageRouter.DroppedMessages.Count("appName") >= 8)
 }
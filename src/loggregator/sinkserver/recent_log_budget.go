@@ -0,0 +1,83 @@
+package sinkserver
+
+import (
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"loggregator/sinks"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recentLogBudgetInterval is how often the recent log budget is enforced.
+const recentLogBudgetInterval = time.Second
+
+// recentLogBudget keeps the recent logs of all apps within maxBytes. When
+// they exceed it, it shrinks the buffers of the least recently active apps
+// first, emptying them if need be.
+type recentLogBudget struct {
+	maxBytes     int
+	usedBytes    int
+	evictedApps  uint64
+	evictedBytes uint64
+	sync.Mutex
+}
+
+func newRecentLogBudget(maxBytes int) *recentLogBudget {
+	return &recentLogBudget{maxBytes: maxBytes}
+}
+
+// enforce shrinks dumps until they fit into the budget. Apps whose buffer
+// it empties count as evicted.
+func (b *recentLogBudget) enforce(dumps []*sinks.DumpSink) {
+	usedBytes := 0
+	for _, dump := range dumps {
+		usedBytes += dump.RetainedBytes()
+	}
+
+	var evictedApps, evictedBytes int
+	if usedBytes > b.maxBytes {
+		sort.Sort(byLastActivity(dumps))
+		for _, dump := range dumps {
+			excess := usedBytes - b.maxBytes
+			if excess <= 0 {
+				break
+			}
+
+			maxBytes := dump.RetainedBytes() - excess
+			if maxBytes < 0 {
+				maxBytes = 0
+			}
+			freed := dump.Shrink(maxBytes)
+			usedBytes -= freed
+			evictedBytes += freed
+			if freed > 0 && dump.RetainedBytes() == 0 {
+				evictedApps++
+			}
+		}
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.usedBytes = usedBytes
+	b.evictedApps += uint64(evictedApps)
+	b.evictedBytes += uint64(evictedBytes)
+}
+
+func (b *recentLogBudget) metrics() []instrumentation.Metric {
+	b.Lock()
+	defer b.Unlock()
+
+	return []instrumentation.Metric{
+		instrumentation.Metric{Name: "recentLogBudgetBytes", Value: b.maxBytes},
+		instrumentation.Metric{Name: "recentLogBudgetUsedBytes", Value: b.usedBytes},
+		instrumentation.Metric{Name: "recentLogEvictedAppCount", Value: b.evictedApps},
+		instrumentation.Metric{Name: "recentLogEvictedByteCount", Value: b.evictedBytes},
+	}
+}
+
+type byLastActivity []*sinks.DumpSink
+
+func (a byLastActivity) Len() int           { return len(a) }
+func (a byLastActivity) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byLastActivity) Less(i, j int) bool { return a[i].LastActivity().Before(a[j].LastActivity()) }
@@ -0,0 +1,53 @@
+package sinkserver
+
+import (
+	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"github.com/cloudfoundry/loggregatorlib/loggertesthelper"
+	messagetesthelpers "github.com/cloudfoundry/loggregatorlib/logmessage/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"loggregator/sinks"
+	"testing"
+	"time"
+)
+
+func newBudgetTestDump(t *testing.T, appId string, messages ...string) *sinks.DumpSink {
+	dump := sinks.NewDumpSink(appId, 10, 0, loggertesthelper.Logger(), make(chan sinks.Sink, 1), time.Second)
+	go dump.Run()
+
+	for _, message := range messages {
+		dump.Channel() <- messagetesthelpers.NewMessage(t, message, appId)
+	}
+	dump.Dump()
+	time.Sleep(time.Millisecond)
+	return dump
+}
+
+func TestRecentLogBudgetShrinksTheLeastRecentlyActiveAppsFirst(t *testing.T) {
+	idle := newBudgetTestDump(t, "idleApp", "1", "2")
+	shrunk := newBudgetTestDump(t, "shrunkApp", "1", "2")
+	active := newBudgetTestDump(t, "activeApp", "1", "2")
+
+	usedBytes := idle.RetainedBytes() + shrunk.RetainedBytes() + active.RetainedBytes()
+	budget := newRecentLogBudget(shrunk.RetainedBytes() + active.RetainedBytes() - 1)
+	budget.enforce([]*sinks.DumpSink{active, shrunk, idle})
+
+	assert.Equal(t, 0, len(idle.Dump()))
+	assert.Equal(t, 1, len(shrunk.Dump()))
+	assert.Equal(t, 2, len(active.Dump()))
+
+	retainedBytes := shrunk.RetainedBytes() + active.RetainedBytes()
+	metrics := budget.metrics()
+	assert.Equal(t, instrumentation.Metric{Name: "recentLogBudgetUsedBytes", Value: retainedBytes}, metrics[1])
+	assert.Equal(t, instrumentation.Metric{Name: "recentLogEvictedAppCount", Value: uint64(1)}, metrics[2])
+	assert.Equal(t, instrumentation.Metric{Name: "recentLogEvictedByteCount", Value: uint64(usedBytes - retainedBytes)}, metrics[3])
+}
+
+func TestRecentLogBudgetLeavesAppsWithinTheBudgetAlone(t *testing.T) {
+	dump := newBudgetTestDump(t, "myApp", "1", "2")
+
+	budget := newRecentLogBudget(dump.RetainedBytes())
+	budget.enforce([]*sinks.DumpSink{dump})
+
+	assert.Equal(t, 2, len(dump.Dump()))
+	assert.Equal(t, instrumentation.Metric{Name: "recentLogEvictedAppCount", Value: uint64(0)}, budget.metrics()[2])
+}
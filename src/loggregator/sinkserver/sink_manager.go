@@ -5,26 +5,53 @@ import (
 	"github.com/cloudfoundry/gosteno"
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"loggregator/dropcounter"
 	"loggregator/groupedsinks"
 	"loggregator/iprange"
 	"loggregator/sinks"
-	"loggregator/sinks/syslogwriter"
+	"loggregator/sinks/ratelimiter"
+	"loggregator/sinks/snapshot"
+	"os"
+	"sort"
 	"time"
 )
 
+// topRetainingApps is the number of apps whose retained recent log bytes
+// are reported.
+const topRetainingApps = 10
+
 type SinkManager struct {
 	sinkOpenChan        chan sinks.Sink
 	sinkCloseChan       chan sinks.Sink
 	errorChannel        chan *logmessage.Message
 	urlBlacklistManager *URLBlacklistManager
 	sinks               *groupedsinks.GroupedSinks
-	skipCertVerify      bool
+	drainRegistry       *sinks.DrainRegistry
+	drainConfig         sinks.DrainConfig
+	appRateLimiters     *ratelimiter.Registry
 	recentLogCount      int
+	recentLogBytes      int
+	recentLogBudget     *recentLogBudget
 	Metrics             *SinkManagerMetrics
-	logger              *gosteno.Logger
+	// BufferDroppedMessages counts the messages the buffers of drains and
+	// websocket sinks drop per app.
+	BufferDroppedMessages *dropcounter.Counter
+	appDropCounters       []*dropcounter.Counter
+	logger                *gosteno.Logger
 }
 
-func NewSinkManager(maxRetainedLogMessages int, skipCertVerify bool, blackListIPs []iprange.IPRange, logger *gosteno.Logger) *SinkManager {
+// NewSinkManager creates a SinkManager retaining up to maxRetainedLogMessages
+// recent messages per app, within maxRetainedLogBytes bytes unless it is 0.
+// Unless recentLogBudgetBytes is 0, the recent messages of all apps are kept
+// within it.
+func NewSinkManager(maxRetainedLogMessages int, maxRetainedLogBytes int, recentLogBudgetBytes int, drainConfig sinks.DrainConfig, blackListIPs []iprange.IPRange, logger *gosteno.Logger) *SinkManager {
+	var budget *recentLogBudget
+	if recentLogBudgetBytes > 0 {
+		budget = newRecentLogBudget(recentLogBudgetBytes)
+	}
+	bufferDroppedMessages := dropcounter.New("truncatingBufferDrops", topDropOffenders)
+	drainConfig.BlacklistIPs = blackListIPs
+	drainConfig.AppDroppedMessages = bufferDroppedMessages
 	return &SinkManager{
 		sinkOpenChan:  make(chan sinks.Sink, 20),
 		sinkCloseChan: make(chan sinks.Sink, 20),
@@ -32,16 +59,33 @@ func NewSinkManager(maxRetainedLogMessages int, skipCertVerify bool, blackListIP
 		urlBlacklistManager: &URLBlacklistManager{
 			blacklistIPs: blackListIPs,
 		},
-		sinks:          groupedsinks.NewGroupedSinks(),
-		skipCertVerify: skipCertVerify,
-		recentLogCount: maxRetainedLogMessages,
-		Metrics:        NewSinkManagerMetrics(),
-		logger:         logger,
+		sinks:                 groupedsinks.NewGroupedSinks(),
+		drainRegistry:         sinks.NewDefaultDrainRegistry(),
+		drainConfig:           drainConfig,
+		appRateLimiters:       ratelimiter.NewRegistry(drainConfig.AppMessageRateLimit, drainConfig.AppByteRateLimit),
+		recentLogCount:        maxRetainedLogMessages,
+		recentLogBytes:        maxRetainedLogBytes,
+		recentLogBudget:       budget,
+		Metrics:               NewSinkManagerMetrics(),
+		BufferDroppedMessages: bufferDroppedMessages,
+		appDropCounters:       []*dropcounter.Counter{bufferDroppedMessages},
+		logger:                logger,
 	}
 }
 
+// NewAppDropCounter creates a drop counter that forgets an app once its last
+// sink is gone. It has to be called before the SinkManager is started.
+func (sinkManager *SinkManager) NewAppDropCounter(name string) *dropcounter.Counter {
+	counter := dropcounter.New(name, topDropOffenders)
+	sinkManager.appDropCounters = append(sinkManager.appDropCounters, counter)
+	return counter
+}
+
 func (sinkManager *SinkManager) Start() {
 	go sinkManager.listenForSinkChanges()
+	if sinkManager.recentLogBudget != nil {
+		go sinkManager.enforceRecentLogBudget()
+	}
 
 	sinkManager.listenForErrorMessages()
 }
@@ -64,6 +108,12 @@ func (sinkManager *SinkManager) listenForSinkChanges() {
 	}
 }
 
+func (sinkManager *SinkManager) enforceRecentLogBudget() {
+	for _ = range time.Tick(recentLogBudgetInterval) {
+		sinkManager.recentLogBudget.enforce(sinkManager.sinks.AllDumps())
+	}
+}
+
 func (sinkManager *SinkManager) listenForErrorMessages() {
 	for errorMessage := range sinkManager.errorChannel {
 		appId := errorMessage.GetLogMessage().GetAppId()
@@ -95,15 +145,27 @@ func (sinkManager *SinkManager) UnregisterSink(sink sinks.Sink) {
 	sinkManager.sinks.Delete(sink)
 	close(sink.Channel())
 
+	if len(sinkManager.sinks.For(sink.AppId())) == 0 {
+		for _, counter := range sinkManager.appDropCounters {
+			counter.Forget(sink.AppId())
+		}
+	}
+
 	sinkManager.Metrics.Dec(sink)
 
-	if syslogSink, ok := sink.(*sinks.SyslogSink); ok {
-		syslogSink.Disconnect()
+	if drain, ok := sink.(sinks.Drain); ok {
+		drain.Disconnect()
 	}
 
 	sinkManager.logger.Infof("SinkManager: Sink with channel %v and identifier %s requested closing. Closed it.", sink.Channel(), sink.Identifier())
 }
 
+// RegisterDrainFactory makes drains for the given URL scheme be built by
+// factory. It has to be called before the SinkManager is started.
+func (sinkManager *SinkManager) RegisterDrainFactory(scheme string, factory sinks.DrainFactory) {
+	sinkManager.drainRegistry.Register(scheme, factory)
+}
+
 func (sinkManager *SinkManager) manageSyslogSinks(appId string, syslogSinkUrls []string) {
 	if len(syslogSinkUrls) == 0 {
 		sinkManager.unregisterAllSyslogSinks(appId)
@@ -117,14 +179,14 @@ func (sinkManager *SinkManager) manageSyslogSinks(appId string, syslogSinkUrls [
 
 func (sinkManager *SinkManager) unregisterAllSyslogSinks(appId string) {
 	for _, sink := range sinkManager.sinks.DrainsFor(appId) {
-		sinkManager.UnregisterSink(sink)
+		sinkManager.unregisterDrain(sink)
 	}
 }
 
 func (sinkManager *SinkManager) unregisterUnboundSyslogSinks(appId string, syslogSinkUrls []string) {
 	for _, sink := range sinkManager.sinks.DrainsFor(appId) {
 		if !contains(sink.Identifier(), syslogSinkUrls) {
-			sinkManager.UnregisterSink(sink)
+			sinkManager.unregisterDrain(sink)
 		}
 	}
 }
@@ -138,16 +200,36 @@ func (sinkManager *SinkManager) registerNewSyslogSinks(appId string, syslogSinkU
 				errorMsg := fmt.Sprintf("SinkManager: Invalid syslog drain URL: %s. Err: %v", syslogSinkUrl, err)
 				sinkManager.sendSyslogErrorToLoggregator(errorMsg, appId)
 			} else {
-				syslogWriter := syslogwriter.NewSyslogWriter(parsedSyslogDrainUrl.Scheme, parsedSyslogDrainUrl.Host, appId, sinkManager.skipCertVerify)
-				syslogSink := sinks.NewSyslogSink(appId, syslogSinkUrl, sinkManager.logger, syslogWriter, sinkManager.errorChannel)
-				if sinkManager.RegisterSink(syslogSink) {
-					go syslogSink.Run()
+				drainConfig := sinkManager.drainConfig
+				drainConfig.AppRateLimiter = sinkManager.appRateLimiters.Acquire(appId)
+				drain, err := sinkManager.drainRegistry.NewDrain(appId, syslogSinkUrl, parsedSyslogDrainUrl, drainConfig, sinkManager.logger, sinkManager.errorChannel)
+				if err != nil {
+					sinkManager.appRateLimiters.Release(appId)
+					sinkManager.urlBlacklistManager.BlacklistUrl(syslogSinkUrl)
+					errorMsg := fmt.Sprintf("SinkManager: Unable to create drain for URL: %s. Err: %v", syslogSinkUrl, err)
+					sinkManager.sendSyslogErrorToLoggregator(errorMsg, appId)
+					continue
+				}
+				if sinkManager.RegisterSink(drain) {
+					go drain.Run()
+				} else {
+					sinkManager.appRateLimiters.Release(appId)
 				}
 			}
 		}
 	}
 }
 
+// unregisterDrain unregisters a drain that was unbound from its app, gives
+// back its share of the rate limiter of the app and has its spool deleted.
+func (sinkManager *SinkManager) unregisterDrain(drain sinks.Sink) {
+	if spoolingDrain, ok := drain.(sinks.SpoolingDrain); ok {
+		spoolingDrain.DiscardSpool()
+	}
+	sinkManager.UnregisterSink(drain)
+	sinkManager.appRateLimiters.Release(drain.AppId())
+}
+
 func (sinkManager *SinkManager) sendSyslogErrorToLoggregator(errorMsg, appId string) {
 	sinkManager.logger.Warnf(errorMsg)
 	logMessage, err := logmessage.GenerateMessage(logmessage.LogMessage_ERR, errorMsg, appId, "LGR")
@@ -163,7 +245,7 @@ func (sinkManager *SinkManager) ensureRecentLogsSinkFor(appId string) {
 		return
 	}
 
-	s := sinks.NewDumpSink(appId, sinkManager.recentLogCount, sinkManager.logger, sinkManager.sinkCloseChan, time.Hour)
+	s := sinks.NewDumpSink(appId, sinkManager.recentLogCount, sinkManager.recentLogBytes, sinkManager.logger, sinkManager.sinkCloseChan, time.Hour)
 
 	if sinkManager.RegisterSink(s) {
 		go s.Run()
@@ -179,8 +261,139 @@ func (sinkManager *SinkManager) recentLogsFor(appId string) []*logmessage.Messag
 	}
 }
 
+// SaveRecentLogs writes the recent logs of all apps to the snapshot file at
+// path and returns how many messages it saved.
+func (sinkManager *SinkManager) SaveRecentLogs(path string) (int, error) {
+	var entries []snapshot.Entry
+	for _, dump := range sinkManager.sinks.AllDumps() {
+		for _, message := range dump.Dump() {
+			entries = append(entries, snapshot.Entry{
+				AppId:     dump.AppId(),
+				Timestamp: time.Unix(0, message.GetLogMessage().GetTimestamp()),
+				Data:      message.GetRawMessage(),
+			})
+		}
+	}
+	return len(entries), snapshot.Write(path, entries)
+}
+
+// RestoreRecentLogs loads the recent logs saved to path, skipping messages
+// older than maxAge, and removes the snapshot so it is not restored twice.
+// It has to be called before messages are routed to the SinkManager.
+func (sinkManager *SinkManager) RestoreRecentLogs(path string, maxAge time.Duration) (restored int, expired int, err error) {
+	entries, expired, err := snapshot.Read(path, maxAge)
+	for _, entry := range entries {
+		message, parseErr := logmessage.ParseMessage(entry.Data)
+		if parseErr != nil {
+			sinkManager.logger.Warnf("SinkManager: Skipping unparsable recent log message of app %s. Err: %v", entry.AppId, parseErr)
+			continue
+		}
+		sinkManager.ensureRecentLogsSinkFor(entry.AppId)
+		if dump := sinkManager.sinks.DumpFor(entry.AppId); dump != nil {
+			dump.Channel() <- message
+			restored++
+		}
+	}
+
+	if err == nil || err == snapshot.ErrCorrupt {
+		os.Remove(path)
+	}
+	return restored, expired, err
+}
+
+// DrainStatuses returns the status of every drain of the given app, or of
+// all drains if appId is empty.
+func (sinkManager *SinkManager) DrainStatuses(appId string) []sinks.DrainStatus {
+	var drains []sinks.Sink
+	if appId == "" {
+		drains = sinkManager.sinks.AllDrains()
+	} else {
+		drains = sinkManager.sinks.DrainsFor(appId)
+	}
+
+	statuses := make([]sinks.DrainStatus, 0, len(drains))
+	for _, sink := range drains {
+		statuses = append(statuses, sink.(sinks.Drain).Status())
+	}
+	return statuses
+}
+
 func (sinkManager *SinkManager) Emit() instrumentation.Context {
-	return sinkManager.Metrics.Emit()
+	context := sinkManager.Metrics.Emit()
+
+	var connected, failing, backingOff, openCircuits int
+	var sent, dropped uint64
+	for _, status := range sinkManager.DrainStatuses("") {
+		if status.Connected {
+			connected++
+		}
+		if status.ConsecutiveFailures > 0 {
+			failing++
+		}
+		if status.BackingOff() {
+			backingOff++
+		}
+		if status.CircuitOpen() {
+			openCircuits++
+		}
+		sent += status.SentMessages
+		dropped += status.DroppedMessages
+	}
+
+	context.Metrics = append(context.Metrics,
+		instrumentation.Metric{Name: "numberOfConnectedDrains", Value: connected},
+		instrumentation.Metric{Name: "numberOfFailingDrains", Value: failing},
+		instrumentation.Metric{Name: "numberOfBackingOffDrains", Value: backingOff},
+		instrumentation.Metric{Name: "numberOfOpenDrainCircuits", Value: openCircuits},
+		instrumentation.Metric{Name: "drainSentMessageCount", Value: sent},
+		instrumentation.Metric{Name: "drainDroppedMessageCount", Value: dropped},
+	)
+	context.Metrics = append(context.Metrics, sinkManager.retainedByteMetrics()...)
+	if sinkManager.recentLogBudget != nil {
+		context.Metrics = append(context.Metrics, sinkManager.recentLogBudget.metrics()...)
+	}
+	return context
+}
+
+// retainedByteMetrics reports the size of the recent logs of all apps and
+// of the apps retaining the most.
+func (sinkManager *SinkManager) retainedByteMetrics() []instrumentation.Metric {
+	var total int
+	var appBytes []appByteCount
+	for _, dump := range sinkManager.sinks.AllDumps() {
+		retained := dump.RetainedBytes()
+		total += retained
+		appBytes = append(appBytes, appByteCount{dump.AppId(), retained})
+	}
+
+	sort.Sort(byByteCount(appBytes))
+	if len(appBytes) > topRetainingApps {
+		appBytes = appBytes[:topRetainingApps]
+	}
+
+	metrics := []instrumentation.Metric{
+		instrumentation.Metric{Name: "retainedLogByteCount", Value: total},
+	}
+	for _, app := range appBytes {
+		metrics = append(metrics, instrumentation.Metric{Name: "retainedLogByteCount:" + app.appId, Value: app.byteCount})
+	}
+	return metrics
+}
+
+type appByteCount struct {
+	appId     string
+	byteCount int
+}
+
+type byByteCount []appByteCount
+
+func (a byByteCount) Len() int      { return len(a) }
+func (a byByteCount) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byByteCount) Less(i, j int) bool {
+	if a[i].byteCount != a[j].byteCount {
+		return a[i].byteCount > a[j].byteCount
+	}
+	return a[i].appId < a[j].appId
 }
 
 func contains(valueToFind string, values []string) bool {
@@ -3,31 +3,33 @@ package sinkserver
 import (
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
 	"loggregator/sinks"
+	"sort"
+	"strings"
 	"sync"
 )
 
 type SinkManagerMetrics struct {
 	DumpSinks      int
 	WebsocketSinks int
-	SyslogSinks    int
+	drainSinks     map[string]int
 	sync.RWMutex
 }
 
 func NewSinkManagerMetrics() *SinkManagerMetrics {
-	return &SinkManagerMetrics{}
+	return &SinkManagerMetrics{drainSinks: make(map[string]int)}
 }
 
 func (sinkManagerMetrics *SinkManagerMetrics) Inc(sink sinks.Sink) {
 	sinkManagerMetrics.Lock()
 	defer sinkManagerMetrics.Unlock()
 
-	switch sink.(type) {
+	switch s := sink.(type) {
 	case *sinks.DumpSink:
 		sinkManagerMetrics.DumpSinks++
-	case *sinks.SyslogSink:
-		sinkManagerMetrics.SyslogSinks++
 	case *sinks.WebsocketSink:
 		sinkManagerMetrics.WebsocketSinks++
+	case sinks.Drain:
+		sinkManagerMetrics.drainSinks[s.DrainType()]++
 	}
 }
 
@@ -35,26 +37,47 @@ func (sinkManagerMetrics *SinkManagerMetrics) Dec(sink sinks.Sink) {
 	sinkManagerMetrics.Lock()
 	defer sinkManagerMetrics.Unlock()
 
-	switch sink.(type) {
+	switch s := sink.(type) {
 	case *sinks.DumpSink:
 		sinkManagerMetrics.DumpSinks--
-	case *sinks.SyslogSink:
-		sinkManagerMetrics.SyslogSinks--
 	case *sinks.WebsocketSink:
 		sinkManagerMetrics.WebsocketSinks--
+	case sinks.Drain:
+		sinkManagerMetrics.drainSinks[s.DrainType()]--
 	}
 }
 
+// DrainSinks returns the number of registered drains of the given type.
+func (sinkManagerMetrics *SinkManagerMetrics) DrainSinks(drainType string) int {
+	sinkManagerMetrics.RLock()
+	defer sinkManagerMetrics.RUnlock()
+
+	return sinkManagerMetrics.drainSinks[drainType]
+}
+
 func (sinkManagerMetrics *SinkManagerMetrics) Emit() instrumentation.Context {
 	sinkManagerMetrics.RLock()
 	defer sinkManagerMetrics.RUnlock()
 
 	data := []instrumentation.Metric{
 		instrumentation.Metric{Name: "numberOfDumpSinks", Value: sinkManagerMetrics.DumpSinks},
-		instrumentation.Metric{Name: "numberOfSyslogSinks", Value: sinkManagerMetrics.SyslogSinks},
+		instrumentation.Metric{Name: "numberOfSyslogSinks", Value: sinkManagerMetrics.drainSinks["syslog"]},
 		instrumentation.Metric{Name: "numberOfWebsocketSinks", Value: sinkManagerMetrics.WebsocketSinks},
 	}
 
+	var drainTypes []string
+	for drainType := range sinkManagerMetrics.drainSinks {
+		if drainType != "syslog" {
+			drainTypes = append(drainTypes, drainType)
+		}
+	}
+	sort.Strings(drainTypes)
+
+	for _, drainType := range drainTypes {
+		name := "numberOf" + strings.Title(drainType) + "Sinks"
+		data = append(data, instrumentation.Metric{Name: name, Value: sinkManagerMetrics.drainSinks[drainType]})
+	}
+
 	return instrumentation.Context{
 		Name:    "messageRouter",
 		Metrics: data,
@@ -79,4 +79,21 @@ var _ = Describe("SinkManagerMetrics", func() {
 		Expect(sinkManagerMetrics.Emit().Metrics[2].Value).To(Equal(0))
 	})
 
+	It("Should have metrics for other drain types", func() {
+
+		Expect(sinkManagerMetrics.Emit().Metrics).To(HaveLen(3))
+
+		sink := &sinks.HttpsSink{}
+		sinkManagerMetrics.Inc(sink)
+
+		Expect(sinkManagerMetrics.Emit().Metrics[1].Value).To(Equal(0))
+		Expect(sinkManagerMetrics.Emit().Metrics[3].Name).To(Equal("numberOfHttpsSinks"))
+		Expect(sinkManagerMetrics.Emit().Metrics[3].Value).To(Equal(1))
+		Expect(sinkManagerMetrics.DrainSinks("https")).To(Equal(1))
+
+		sinkManagerMetrics.Dec(sink)
+
+		Expect(sinkManagerMetrics.Emit().Metrics[3].Value).To(Equal(0))
+	})
+
 })
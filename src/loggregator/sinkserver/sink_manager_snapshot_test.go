@@ -0,0 +1,71 @@
+package sinkserver
+
+import (
+	"github.com/cloudfoundry/loggregatorlib/loggertesthelper"
+	messagetesthelpers "github.com/cloudfoundry/loggregatorlib/logmessage/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"loggregator/sinks"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecentLogsSurviveARestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recent_logs.snapshot")
+
+	sinkManager := NewSinkManager(10, 0, 0, sinks.DrainConfig{}, nil, loggertesthelper.Logger())
+	for _, appId := range []string{"app1", "app2"} {
+		sinkManager.ensureRecentLogsSinkFor(appId)
+		sinkManager.SendTo(appId, messagetesthelpers.NewMessage(t, appId+" message 1", appId))
+		sinkManager.SendTo(appId, messagetesthelpers.NewMessage(t, appId+" message 2", appId))
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	saved, err := sinkManager.SaveRecentLogs(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, saved)
+
+	restartedSinkManager := NewSinkManager(10, 0, 0, sinks.DrainConfig{}, nil, loggertesthelper.Logger())
+	restored, expired, err := restartedSinkManager.RestoreRecentLogs(path, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, restored)
+	assert.Equal(t, 0, expired)
+	time.Sleep(10 * time.Millisecond)
+
+	for _, appId := range []string{"app1", "app2"} {
+		messages := restartedSinkManager.recentLogsFor(appId)
+		assert.Equal(t, 2, len(messages))
+		assert.Equal(t, appId+" message 1", string(messages[0].GetLogMessage().GetMessage()))
+		assert.Equal(t, appId+" message 2", string(messages[1].GetLogMessage().GetMessage()))
+	}
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRestoreRecentLogsSkipsExpiredMessages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recent_logs.snapshot")
+
+	sinkManager := NewSinkManager(10, 0, 0, sinks.DrainConfig{}, nil, loggertesthelper.Logger())
+	sinkManager.ensureRecentLogsSinkFor("myApp")
+	sinkManager.SendTo("myApp", messagetesthelpers.NewMessage(t, "message", "myApp"))
+	time.Sleep(10 * time.Millisecond)
+	_, err = sinkManager.SaveRecentLogs(path)
+	assert.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	restartedSinkManager := NewSinkManager(10, 0, 0, sinks.DrainConfig{}, nil, loggertesthelper.Logger())
+	restored, expired, err := restartedSinkManager.RestoreRecentLogs(path, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, restored)
+	assert.Equal(t, 1, expired)
+}
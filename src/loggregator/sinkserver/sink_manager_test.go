@@ -8,6 +8,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"loggregator/iprange"
+	"loggregator/sinks"
 	"loggregator/sinkserver"
 )
 
@@ -31,7 +32,7 @@ var _ = Describe("SinkManager", func() {
 	var sinkManager *sinkserver.SinkManager
 
 	BeforeEach(func() {
-		sinkManager = sinkserver.NewSinkManager(1, true, []iprange.IPRange{}, loggertesthelper.Logger())
+		sinkManager = sinkserver.NewSinkManager(1, 0, 0, sinks.DrainConfig{SkipCertVerify: true}, []iprange.IPRange{}, loggertesthelper.Logger())
 		go sinkManager.Start()
 	})
 
@@ -6,6 +6,7 @@ import (
 	"github.com/cloudfoundry/gosteno"
 	"github.com/cloudfoundry/loggregatorlib/appid"
 	"github.com/cloudfoundry/loggregatorlib/logmessage"
+	"loggregator/buffer/truncatingbuffer"
 	"loggregator/sinks"
 	"net"
 	"net/http"
@@ -22,15 +23,20 @@ type websocketServer struct {
 	sinkManager       *SinkManager
 	keepAliveInterval time.Duration
 	bufferSize        uint
+	overflowPolicy    truncatingbuffer.Policy
 	logger            *gosteno.Logger
 }
 
-func NewWebsocketServer(apiEndpoint string, sinkManager *SinkManager, keepAliveInterval time.Duration, wSMessageBufferSize uint, logger *gosteno.Logger) *websocketServer {
+// NewWebsocketServer creates a server for tailing and dumping logs. The
+// messages of tailing clients are buffered in wSMessageBufferSize messages,
+// which overflow as told by overflowPolicy.
+func NewWebsocketServer(apiEndpoint string, sinkManager *SinkManager, keepAliveInterval time.Duration, wSMessageBufferSize uint, overflowPolicy truncatingbuffer.Policy, logger *gosteno.Logger) *websocketServer {
 	return &websocketServer{
 		apiEndpoint:       apiEndpoint,
 		sinkManager:       sinkManager,
 		keepAliveInterval: keepAliveInterval,
 		bufferSize:        wSMessageBufferSize,
+		overflowPolicy:    overflowPolicy,
 		logger:            logger,
 	}
 }
@@ -72,6 +78,8 @@ func (websocketServer *websocketServer) streamLogs(ws *websocket.Conn) {
 		websocketServer.sinkManager.sinkCloseChan,
 		websocketServer.keepAliveInterval,
 		websocketServer.bufferSize,
+		websocketServer.overflowPolicy,
+		websocketServer.sinkManager.BufferDroppedMessages,
 	)
 	websocketServer.logger.Debugf("WebsocketServer: Requesting a wss sink for app %s", websocketSink.AppId())
 	websocketServer.sinkManager.sinkOpenChan <- websocketSink
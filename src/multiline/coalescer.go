@@ -0,0 +1,132 @@
+package multiline
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	DefaultFlushTimeout = 500 * time.Millisecond
+	DefaultMaxBytes     = 64 * 1024
+)
+
+// Config describes how lines are coalesced into messages. Lines matching
+// ContinuationPattern continue the message of the line before them. Without
+// a pattern, lines starting with whitespace are continuations. Zero values
+// of FlushTimeoutMilliseconds and MaxBytes select the defaults.
+type Config struct {
+	ContinuationPattern      string
+	FlushTimeoutMilliseconds int
+	MaxBytes                 int
+}
+
+// Validate reports whether a Coalescer can be built from the config.
+func (config Config) Validate() error {
+	_, err := NewCoalescer(config)
+	return err
+}
+
+// Coalescer merges lines into multi-line messages, e.g. stack traces. A
+// message is complete once a line that does not continue it arrives, once
+// it would grow beyond the maximum size, or once no line arrived for the
+// flush timeout. A Coalescer is not safe for concurrent use.
+type Coalescer struct {
+	continuation *regexp.Regexp
+	flushTimeout time.Duration
+	maxBytes     int
+	pending      []byte
+	deadline     time.Time
+}
+
+func NewCoalescer(config Config) (*Coalescer, error) {
+	coalescer := &Coalescer{
+		flushTimeout: time.Duration(config.FlushTimeoutMilliseconds) * time.Millisecond,
+		maxBytes:     config.MaxBytes,
+	}
+
+	if config.ContinuationPattern != "" {
+		continuation, err := regexp.Compile(config.ContinuationPattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid continuation pattern %s: %v", config.ContinuationPattern, err)
+		}
+		coalescer.continuation = continuation
+	}
+	if coalescer.flushTimeout < 0 || coalescer.maxBytes < 0 {
+		return nil, fmt.Errorf("Flush timeout and maximum size must not be negative")
+	}
+	if coalescer.flushTimeout == 0 {
+		coalescer.flushTimeout = DefaultFlushTimeout
+	}
+	if coalescer.maxBytes == 0 {
+		coalescer.maxBytes = DefaultMaxBytes
+	}
+
+	return coalescer, nil
+}
+
+// Add adds a line, without its line break, and returns the message it
+// completed, if any. Empty lines are ignored.
+func (c *Coalescer) Add(line []byte) []byte {
+	if len(line) == 0 {
+		return nil
+	}
+	c.deadline = time.Now().Add(c.flushTimeout)
+
+	if c.pending != nil && c.continues(line) && len(c.pending)+1+len(line) <= c.maxBytes {
+		c.pending = append(c.pending, '\n')
+		c.pending = append(c.pending, line...)
+		return nil
+	}
+
+	completed := c.pending
+	c.pending = append([]byte(nil), line...)
+	return completed
+}
+
+func (c *Coalescer) continues(line []byte) bool {
+	if c.continuation != nil {
+		return c.continuation.Match(line)
+	}
+	return len(line) > 0 && (line[0] == ' ' || line[0] == '\t')
+}
+
+// Flush returns the pending message, if any, and starts over.
+func (c *Coalescer) Flush() []byte {
+	completed := c.pending
+	c.pending = nil
+	c.deadline = time.Time{}
+	return completed
+}
+
+// Pending reports whether part of a message is waiting for more lines.
+func (c *Coalescer) Pending() bool {
+	return c.pending != nil
+}
+
+// Deadline returns when the pending message has to be flushed. It is zero
+// if there is no pending message.
+func (c *Coalescer) Deadline() time.Time {
+	return c.deadline
+}
+
+// Expired reports whether the pending message is due to be flushed.
+func (c *Coalescer) Expired(now time.Time) bool {
+	return c.pending != nil && !now.Before(c.deadline)
+}
+
+// FlushTimeout returns how long a pending message waits for more lines.
+func (c *Coalescer) FlushTimeout() time.Duration {
+	return c.flushTimeout
+}
+
+// Lines splits data read from a stream into lines without line breaks.
+func Lines(data []byte) [][]byte {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimSuffix(line, []byte("\r"))
+	}
+	return lines
+}
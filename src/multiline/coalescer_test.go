@@ -0,0 +1,73 @@
+package multiline
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLinesStartingWithWhitespaceContinueTheMessage(t *testing.T) {
+	coalescer, err := NewCoalescer(Config{})
+	assert.NoError(t, err)
+
+	assert.Nil(t, coalescer.Add([]byte("Exception in thread main")))
+	assert.Nil(t, coalescer.Add([]byte("\tat Foo.bar(Foo.java:12)")))
+	assert.Nil(t, coalescer.Add([]byte("")))
+	assert.Nil(t, coalescer.Add([]byte("    at Foo.main(Foo.java:3)")))
+
+	completed := coalescer.Add([]byte("next message"))
+	assert.Equal(t, "Exception in thread main\n\tat Foo.bar(Foo.java:12)\n    at Foo.main(Foo.java:3)", string(completed))
+	assert.Equal(t, "next message", string(coalescer.Flush()))
+	assert.False(t, coalescer.Pending())
+}
+
+func TestContinuationPattern(t *testing.T) {
+	coalescer, err := NewCoalescer(Config{ContinuationPattern: `^(from |Caused by:)`})
+	assert.NoError(t, err)
+
+	coalescer.Add([]byte("NoMethodError: undefined method"))
+	coalescer.Add([]byte("from app.rb:3"))
+	completed := coalescer.Add([]byte("  indented but no continuation"))
+
+	assert.Equal(t, "NoMethodError: undefined method\nfrom app.rb:3", string(completed))
+}
+
+func TestInvalidConfig(t *testing.T) {
+	_, err := NewCoalescer(Config{ContinuationPattern: "("})
+	assert.Error(t, err)
+
+	err = Config{MaxBytes: -1}.Validate()
+	assert.Error(t, err)
+}
+
+func TestMessagesDoNotGrowBeyondMaxBytes(t *testing.T) {
+	coalescer, _ := NewCoalescer(Config{MaxBytes: 10})
+
+	coalescer.Add([]byte("12345"))
+	assert.Nil(t, coalescer.Add([]byte(" 789")))
+	completed := coalescer.Add([]byte(" abc"))
+
+	assert.Equal(t, "12345\n 789", string(completed))
+	assert.Equal(t, " abc", string(coalescer.Flush()))
+}
+
+func TestPendingMessagesExpireAfterTheFlushTimeout(t *testing.T) {
+	coalescer, _ := NewCoalescer(Config{FlushTimeoutMilliseconds: 50})
+	assert.Equal(t, 50*time.Millisecond, coalescer.FlushTimeout())
+	assert.True(t, coalescer.Deadline().IsZero())
+	assert.False(t, coalescer.Expired(time.Now()))
+
+	coalescer.Add([]byte("line"))
+	assert.False(t, coalescer.Expired(time.Now()))
+	assert.True(t, coalescer.Expired(time.Now().Add(50*time.Millisecond)))
+	assert.True(t, coalescer.Deadline().After(time.Now()))
+}
+
+func TestLines(t *testing.T) {
+	lines := Lines([]byte("one\r\ntwo\n\tthree\n"))
+
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, "one", string(lines[0]))
+	assert.Equal(t, "two", string(lines[1]))
+	assert.Equal(t, "\tthree", string(lines[2]))
+}